@@ -3,7 +3,9 @@ package config
 import (
 	"log"
 	"os"
-	// "path/filepath"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,15 +19,15 @@ type Config struct {
 
 	// 数据库配置
 	Database struct {
-		Type     string // mysql, postgres, sqlite
-		Host     string
-		Port     string
-		User     string
-		Password string
-		Name     string
-		Charset  string
+		Type      string // mysql, postgres, sqlite
+		Host      string
+		Port      string
+		User      string
+		Password  string
+		Name      string
+		Charset   string
 		ParseTime bool
-		Loc      string
+		Loc       string
 	}
 
 	// JWT配置
@@ -38,6 +40,57 @@ type Config struct {
 	CORS struct {
 		AllowOrigins []string
 	}
+
+	// 消息配置
+	Message struct {
+		EditWindow   time.Duration // 发送后允许编辑的时长
+		RecallWindow time.Duration // 发送后允许撤回的时长，群管理员不受限制
+	}
+
+	// 文件存储配置
+	Storage struct {
+		Driver   string // local, s3
+		LocalDir string // 本地存储的根目录
+		S3       struct {
+			Endpoint  string
+			Region    string
+			Bucket    string
+			AccessKey string
+			SecretKey string
+			PathStyle bool // MinIO等自建服务需要使用路径风格的地址
+		}
+	}
+
+	// 上传配置
+	Upload struct {
+		MaxSize      int64         // 单个文件的最大字节数
+		ChunkSize    int64         // 分片上传时建议的分片大小
+		TempDir      string        // 分片上传的暂存目录
+		SessionTTL   time.Duration // 分片上传会话的有效期
+		AllowedTypes []string      // 允许的MIME类型，以"/"结尾的表示该大类下的全部类型
+	}
+
+	// 图片处理配置
+	Media struct {
+		Workers        int   // 图片处理的并发数
+		QueueSize      int   // 等待处理的任务数上限
+		MaxPixels      int   // 允许解码的最大像素数，防止超大图片耗尽内存
+		ThumbnailSizes []int // 缩略图的最长边
+		AvatarSizes    []int // 头像的边长
+	}
+
+	// 消息搜索配置
+	Search struct {
+		Driver        string // mysql, memory
+		MemoryMaxDocs int    // memory索引最多保存的消息数，超出后淘汰最早的消息
+	}
+
+	// 好友配置
+	Friend struct {
+		RequestTTL     time.Duration // 好友请求的有效期，超时未处理自动过期
+		RejectCooldown time.Duration // 好友请求被拒绝后，多久之后才能再次向对方发送请求
+		SuggestionTTL  time.Duration // 好友推荐结果的缓存时间
+	}
 }
 
 // AppConfig 全局配置实例
@@ -77,6 +130,42 @@ func setDefaultConfig() {
 
 	// CORS配置
 	AppConfig.CORS.AllowOrigins = []string{"*"}
+
+	// 消息配置
+	AppConfig.Message.EditWindow = 15 * time.Minute
+	AppConfig.Message.RecallWindow = 2 * time.Minute
+
+	// 文件存储配置
+	AppConfig.Storage.Driver = "local"
+	AppConfig.Storage.LocalDir = "uploads"
+	AppConfig.Storage.S3.Region = "us-east-1"
+
+	// 上传配置
+	AppConfig.Upload.MaxSize = 20 << 20
+	AppConfig.Upload.ChunkSize = 1 << 20
+	AppConfig.Upload.TempDir = filepath.Join(os.TempDir(), "gin-vue-chat-uploads")
+	AppConfig.Upload.SessionTTL = 24 * time.Hour
+	AppConfig.Upload.AllowedTypes = []string{
+		"image/jpeg", "image/png", "image/gif", "image/webp",
+		"video/", "audio/",
+		"application/pdf", "application/zip", "text/plain",
+	}
+
+	// 图片处理配置
+	AppConfig.Media.Workers = 2
+	AppConfig.Media.QueueSize = 256
+	AppConfig.Media.MaxPixels = 50 * 1000 * 1000
+	AppConfig.Media.ThumbnailSizes = []int{160, 320, 640}
+	AppConfig.Media.AvatarSizes = []int{64, 256}
+
+	// 消息搜索配置
+	AppConfig.Search.Driver = "mysql"
+	AppConfig.Search.MemoryMaxDocs = 100000
+
+	// 好友配置
+	AppConfig.Friend.RequestTTL = 7 * 24 * time.Hour
+	AppConfig.Friend.RejectCooldown = 24 * time.Hour
+	AppConfig.Friend.SuggestionTTL = time.Hour
 }
 
 // 从环境变量加载配置
@@ -116,4 +205,105 @@ func loadFromEnv() {
 	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
 		AppConfig.JWT.Secret = jwtSecret
 	}
+
+	// 消息配置
+	if editWindow := os.Getenv("MESSAGE_EDIT_WINDOW"); editWindow != "" {
+		if d, err := time.ParseDuration(editWindow); err == nil {
+			AppConfig.Message.EditWindow = d
+		} else {
+			log.Printf("无效的MESSAGE_EDIT_WINDOW: %s", editWindow)
+		}
+	}
+	if recallWindow := os.Getenv("MESSAGE_RECALL_WINDOW"); recallWindow != "" {
+		if d, err := time.ParseDuration(recallWindow); err == nil {
+			AppConfig.Message.RecallWindow = d
+		} else {
+			log.Printf("无效的MESSAGE_RECALL_WINDOW: %s", recallWindow)
+		}
+	}
+
+	// 文件存储配置
+	if driver := os.Getenv("STORAGE_DRIVER"); driver != "" {
+		AppConfig.Storage.Driver = driver
+	}
+	if localDir := os.Getenv("STORAGE_LOCAL_DIR"); localDir != "" {
+		AppConfig.Storage.LocalDir = localDir
+	}
+	if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+		AppConfig.Storage.S3.Endpoint = endpoint
+	}
+	if region := os.Getenv("S3_REGION"); region != "" {
+		AppConfig.Storage.S3.Region = region
+	}
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		AppConfig.Storage.S3.Bucket = bucket
+	}
+	if accessKey := os.Getenv("S3_ACCESS_KEY"); accessKey != "" {
+		AppConfig.Storage.S3.AccessKey = accessKey
+	}
+	if secretKey := os.Getenv("S3_SECRET_KEY"); secretKey != "" {
+		AppConfig.Storage.S3.SecretKey = secretKey
+	}
+	if pathStyle := os.Getenv("S3_PATH_STYLE"); pathStyle != "" {
+		AppConfig.Storage.S3.PathStyle = pathStyle == "true" || pathStyle == "1"
+	}
+
+	// 上传配置
+	if maxSize := os.Getenv("UPLOAD_MAX_SIZE"); maxSize != "" {
+		if n, err := strconv.ParseInt(maxSize, 10, 64); err == nil && n > 0 {
+			AppConfig.Upload.MaxSize = n
+		} else {
+			log.Printf("无效的UPLOAD_MAX_SIZE: %s", maxSize)
+		}
+	}
+	if tempDir := os.Getenv("UPLOAD_TEMP_DIR"); tempDir != "" {
+		AppConfig.Upload.TempDir = tempDir
+	}
+	if allowedTypes := os.Getenv("UPLOAD_ALLOWED_TYPES"); allowedTypes != "" {
+		AppConfig.Upload.AllowedTypes = strings.Split(allowedTypes, ",")
+	}
+
+	// 图片处理配置
+	if workers := os.Getenv("MEDIA_WORKERS"); workers != "" {
+		if n, err := strconv.Atoi(workers); err == nil && n > 0 {
+			AppConfig.Media.Workers = n
+		} else {
+			log.Printf("无效的MEDIA_WORKERS: %s", workers)
+		}
+	}
+
+	// 消息搜索配置
+	if driver := os.Getenv("SEARCH_DRIVER"); driver != "" {
+		AppConfig.Search.Driver = driver
+	}
+	if maxDocs := os.Getenv("SEARCH_MEMORY_MAX_DOCS"); maxDocs != "" {
+		if n, err := strconv.Atoi(maxDocs); err == nil && n > 0 {
+			AppConfig.Search.MemoryMaxDocs = n
+		} else {
+			log.Printf("无效的SEARCH_MEMORY_MAX_DOCS: %s", maxDocs)
+		}
+	}
+
+	// 好友配置
+	if requestTTL := os.Getenv("FRIEND_REQUEST_TTL"); requestTTL != "" {
+		if d, err := time.ParseDuration(requestTTL); err == nil && d > 0 {
+			AppConfig.Friend.RequestTTL = d
+		} else {
+			log.Printf("无效的FRIEND_REQUEST_TTL: %s", requestTTL)
+		}
+	}
+	if rejectCooldown := os.Getenv("FRIEND_REJECT_COOLDOWN"); rejectCooldown != "" {
+		if d, err := time.ParseDuration(rejectCooldown); err == nil && d >= 0 {
+			AppConfig.Friend.RejectCooldown = d
+		} else {
+			log.Printf("无效的FRIEND_REJECT_COOLDOWN: %s", rejectCooldown)
+		}
+	}
+	if suggestionTTL := os.Getenv("FRIEND_SUGGESTION_TTL"); suggestionTTL != "" {
+		if d, err := time.ParseDuration(suggestionTTL); err == nil && d > 0 {
+			AppConfig.Friend.SuggestionTTL = d
+		} else {
+			log.Printf("无效的FRIEND_SUGGESTION_TTL: %s", suggestionTTL)
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/storage"
+)
+
+// GetAttachment 获取附件信息
+func GetAttachment(c *gin.Context) {
+	attachment, ok := loadAccessibleAttachment(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": attachment})
+}
+
+// DownloadAttachment 下载附件内容，只有上传者和附件所在会话的成员可以下载
+func DownloadAttachment(c *gin.Context) {
+	attachment, ok := loadAccessibleAttachment(c)
+	if !ok {
+		return
+	}
+
+	// 图片处理完成前原图可能还带有EXIF等元数据，只有上传者可以下载。
+	// 处理失败的图片没有去除元数据的版本，同样不对其他成员提供原图
+	userID := c.GetString("userId")
+	if userID != strconv.FormatUint(uint64(attachment.UploaderID), 10) {
+		switch attachment.MediaStatus {
+		case models.MediaStatusPending:
+			c.JSON(http.StatusConflict, gin.H{"error": "图片处理中，请稍后重试"})
+			return
+		case models.MediaStatusFailed:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "图片无法处理"})
+			return
+		}
+	}
+
+	// 图片和音视频在浏览器中直接展示，其他文件一律作为下载处理
+	disposition := "attachment"
+	if attachment.Kind != models.AttachmentKindFile {
+		disposition = "inline"
+	}
+	if attachment.FileName != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName})
+	}
+
+	serveStorageObject(c, attachment.StorageKey, attachment.Size, attachment.ContentType, disposition)
+}
+
+// GetAttachmentThumbnail 获取图片附件的缩略图，size为需要的最长边，返回不小于size的最小规格
+func GetAttachmentThumbnail(c *gin.Context) {
+	attachment, ok := loadAccessibleAttachment(c)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "0"))
+	if err != nil || size < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的缩略图尺寸"})
+		return
+	}
+
+	thumbnail := attachment.Thumbnail(size)
+	if thumbnail == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "缩略图不存在"})
+		return
+	}
+
+	key := models.ThumbnailStorageKey(attachment.SHA256, thumbnail.Size, thumbnail.ContentType)
+	serveStorageObject(c, key, -1, thumbnail.ContentType, "inline")
+}
+
+// serveStorageObject 将存储中的对象写入响应，size为-1时不设置Content-Length
+func serveStorageObject(c *gin.Context, key string, size int64, contentType, disposition string) {
+	reader, err := storage.Store.Get(c.Request.Context(), key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, reader, map[string]string{
+		"Content-Disposition":    disposition,
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=86400",
+	})
+}
+
+// loadAccessibleAttachment 读取路径中的附件并检查当前用户的访问权限，失败时已写入响应
+func loadAccessibleAttachment(c *gin.Context) (*models.Attachment, bool) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return nil, false
+	}
+
+	attachmentIDStr := c.Param("id")
+	attachmentID, err := strconv.ParseUint(attachmentIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的附件ID"})
+		return nil, false
+	}
+
+	attachment, err := models.GetAttachmentByID(uint(attachmentID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return nil, false
+	}
+
+	if err := checkAttachmentAccess(attachment, uint(userID)); err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	return attachment, true
+}
+
+// checkAttachmentAccess 上传者始终可以访问自己的附件；
+// 发送后，与查看聊天记录相同，会话成员可以访问，消息撤回或对自己隐藏后不能再访问
+func checkAttachmentAccess(attachment *models.Attachment, userID uint) error {
+	if attachment.UploaderID == userID {
+		return nil
+	}
+	// 尚未发送的附件不对外暴露
+	if attachment.MessageID == nil {
+		return newRequestError(http.StatusNotFound, "附件不存在")
+	}
+
+	message, err := models.GetMessageByID(*attachment.MessageID)
+	if err != nil || message.Recalled {
+		return newRequestError(http.StatusNotFound, "附件不存在")
+	}
+
+	if _, err := getConversationParticipants(message, userID); err != nil {
+		return err
+	}
+	// 对自己隐藏的消息中的附件同样不可访问
+	hidden, err := models.GetHiddenMessageIDs(userID, []uint{message.ID})
+	if err != nil {
+		return newRequestError(http.StatusInternalServerError, "获取附件失败")
+	}
+	if hidden[message.ID] {
+		return newRequestError(http.StatusNotFound, "附件不存在")
+	}
+	return nil
+}
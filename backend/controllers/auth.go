@@ -74,14 +74,6 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 更新用户状态为在线
-	user.Status = "online"
-	err = models.UpdateUser(user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户状态失败"})
-		return
-	}
-
 	// 生成JWT令牌
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userId":   strconv.FormatUint(uint64(user.ID), 10),
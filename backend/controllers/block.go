@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// BlockUserRequest 屏蔽用户请求
+type BlockUserRequest struct {
+	UserID uint `json:"userId" binding:"required"`
+}
+
+// GetBlockedUsers 获取当前用户屏蔽的用户列表
+func GetBlockedUsers(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	blocks, err := models.GetBlockedUsers(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取屏蔽列表失败"})
+		return
+	}
+
+	blockedIDs := make([]uint, 0, len(blocks))
+	for _, block := range blocks {
+		blockedIDs = append(blockedIDs, block.BlockedID)
+	}
+	users, err := models.GetUsersByIDs(blockedIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取屏蔽列表失败"})
+		return
+	}
+	usersByID := make(map[uint]*models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	items := make([]gin.H, 0, len(blocks))
+	for _, block := range blocks {
+		user, ok := usersByID[block.BlockedID]
+		if !ok {
+			continue // 跳过已注销的用户
+		}
+		items = append(items, gin.H{
+			"id":        user.ID,
+			"username":  user.Username,
+			"avatar":    user.Avatar,
+			"blockedAt": block.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocks": items})
+}
+
+// BlockUser 屏蔽用户。对方不会收到任何提示：发给自己的私聊消息只对对方可见，
+// 好友请求不会出现在自己的列表中，双方互相看不到在线状态和正在输入
+func BlockUser(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req BlockUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+	if req.UserID == uint(userID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能屏蔽自己"})
+		return
+	}
+	if _, err := models.GetUserByID(req.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	block, err := models.BlockUser(uint(userID), req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "屏蔽用户失败"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	hub.SetBlocked(userIDStr, strconv.FormatUint(uint64(req.UserID), 10), true)
+
+	// 对方看到自己在屏蔽时下线，与正常下线的事件相同
+	pushToUser(hub, req.UserID, map[string]interface{}{
+		"type":       "presence",
+		"userId":     uint(userID),
+		"status":     websocket.PresenceOffline,
+		"lastSeenAt": block.CreatedAt,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "已屏蔽该用户"})
+}
+
+// UnblockUser 取消屏蔽，双方重新收到对方当前的在线状态
+func UnblockUser(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	blockedIDStr := c.Param("userId")
+	blockedID, err := strconv.ParseUint(blockedIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := models.UnblockUser(uint(userID), uint(blockedID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消屏蔽失败"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	hub.SetBlocked(userIDStr, blockedIDStr, false)
+
+	// 对方也屏蔽了自己时，双方仍然互相隐藏
+	if !hub.IsBlockedBetween(userIDStr, blockedIDStr) {
+		pushCurrentPresence(hub, uint(userID), uint(blockedID))
+		pushCurrentPresence(hub, uint(blockedID), uint(userID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消屏蔽"})
+}
+
+// loadBlockList 启动时将全部屏蔽关系加载到Hub，用于过滤瞬时事件
+func loadBlockList(hub *websocket.Hub) {
+	blocks, err := models.GetAllBlocks()
+	if err != nil {
+		log.Printf("加载屏蔽列表失败: %v", err)
+		return
+	}
+	for _, block := range blocks {
+		hub.SetBlocked(strconv.FormatUint(uint64(block.UserID), 10), strconv.FormatUint(uint64(block.BlockedID), 10), true)
+	}
+}
+
+// checkBlockedPeer 检查私聊双方的屏蔽关系。发送者屏蔽了接收者时返回错误；
+// 接收者屏蔽了发送者时返回true，调用方应当静默处理，不让发送者察觉
+func checkBlockedPeer(senderID, receiverID uint) (bool, error) {
+	blocked, err := models.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return false, newRequestError(http.StatusInternalServerError, "服务器错误")
+	}
+	if blocked {
+		return false, newRequestError(http.StatusForbidden, "您已屏蔽该用户，请先取消屏蔽")
+	}
+
+	shadow, err := models.IsBlocked(receiverID, senderID)
+	if err != nil {
+		return false, newRequestError(http.StatusInternalServerError, "服务器错误")
+	}
+	return shadow, nil
+}
+
+// getBlockerSet 获取屏蔽了该用户的用户及屏蔽的时间，查询失败时返回空集合
+func getBlockerSet(userID uint) map[uint]time.Time {
+	blockers := make(map[uint]time.Time)
+	blocks, err := models.GetBlockers(userID)
+	if err != nil {
+		log.Printf("获取屏蔽关系失败: %v", err)
+		return blockers
+	}
+	for _, block := range blocks {
+		blockers[block.UserID] = block.CreatedAt
+	}
+	return blockers
+}
+
+// visiblePresence 对屏蔽了查看者的用户显示为离线，最后在线时间停留在屏蔽的时间，
+// 与屏蔽时推送的离线事件一致，看起来和正常下线相同
+func visiblePresence(user *models.User, blockers map[uint]time.Time) (string, *time.Time) {
+	if blockedAt, ok := blockers[user.ID]; ok {
+		return websocket.PresenceOffline, &blockedAt
+	}
+	return user.Status, user.LastSeenAt
+}
+
+// pushCurrentPresence 将userID当前的在线状态推送给recipientID
+func pushCurrentPresence(hub *websocket.Hub, userID, recipientID uint) {
+	status, lastSeenAt := hub.UserPresence(strconv.FormatUint(uint64(userID), 10))
+	pushToUser(hub, recipientID, map[string]interface{}{
+		"type":       "presence",
+		"userId":     userID,
+		"status":     status,
+		"lastSeenAt": lastSeenAt,
+	})
+}
+
+// withoutShadowedReceiver 私聊消息对接收者隐藏（被屏蔽或仅对自己删除）时，从推送对象中去掉接收者
+func withoutShadowedReceiver(message *models.Message, userIDs []uint) []uint {
+	if message.Type != models.MessageTypePrivate {
+		return userIDs
+	}
+	hidden, err := models.GetHiddenMessageIDs(message.ReceiverID, []uint{message.ID})
+	if err != nil || !hidden[message.ID] {
+		return userIDs
+	}
+
+	result := make([]uint, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != message.ReceiverID {
+			result = append(result, userID)
+		}
+	}
+	return result
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// UpdateConversationRequest 更新会话设置请求，未提供的字段保持不变
+type UpdateConversationRequest struct {
+	Muted  *bool `json:"muted"`
+	Pinned *bool `json:"pinned"`
+}
+
+// conversationEntry 会话列表中的一项
+type conversationEntry struct {
+	ConversationKey string                 `json:"conversationKey"`
+	Type            string                 `json:"type"`
+	PeerID          uint                   `json:"peerId,omitempty"`
+	GroupID         uint                   `json:"groupId,omitempty"`
+	Name            string                 `json:"name"`
+	Avatar          string                 `json:"avatar"`
+	LastMessage     *models.MessagePreview `json:"lastMessage"`
+	UnreadCount     int                    `json:"unreadCount"`
+	Muted           bool                   `json:"muted"`
+	Pinned          bool                   `json:"pinned"`
+	PinnedAt        *time.Time             `json:"-"`
+	UpdatedAt       time.Time              `json:"updatedAt"` // 最后一条消息的时间，没有消息时为会话建立的时间
+}
+
+// GetConversations 获取当前用户的会话列表，置顶的会话在前，其余按最近活动时间倒序
+func GetConversations(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	// 好友关系和群成员身份决定会话是否可见，会话摘要表提供未读数和设置
+	memberships, err := getUserConversations(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	summaries, err := models.GetUserConversations(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	keys := make([]string, 0, len(memberships))
+	peerIDs := make([]uint, 0, len(memberships))
+	for _, membership := range memberships {
+		keys = append(keys, membership.Key)
+		if membership.PeerID != 0 {
+			peerIDs = append(peerIDs, membership.PeerID)
+		}
+	}
+
+	conversations, err := models.GetConversationsByKeys(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	lastMessageIDs, err := getVisibleLastMessageIDs(uint(userID), conversations)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+	ids := make([]uint, 0, len(lastMessageIDs))
+	for _, id := range lastMessageIDs {
+		ids = append(ids, id)
+	}
+	previews, err := models.GetMessagePreviews(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	peers, err := models.GetUsersByIDs(peerIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+	peersByID := make(map[uint]*models.User, len(peers))
+	for _, peer := range peers {
+		peersByID[peer.ID] = peer
+	}
+
+	groups, err := models.GetGroupsByUserID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+	groupsByID := make(map[uint]*models.Group, len(groups))
+	for _, group := range groups {
+		groupsByID[group.ID] = group
+	}
+
+	entries := make([]*conversationEntry, 0, len(memberships))
+	for _, membership := range memberships {
+		entry := &conversationEntry{
+			ConversationKey: membership.Key,
+			Type:            membership.Type,
+			PeerID:          membership.PeerID,
+			GroupID:         membership.GroupID,
+			UpdatedAt:       membership.CreatedAt,
+		}
+
+		if peer := peersByID[membership.PeerID]; peer != nil {
+			entry.Name = peer.Username
+			entry.Avatar = peer.Avatar
+		}
+		if group := groupsByID[membership.GroupID]; group != nil {
+			entry.Name = group.Name
+			entry.Avatar = group.Avatar
+		}
+
+		if preview := previews[lastMessageIDs[membership.Key]]; preview != nil {
+			entry.LastMessage = preview
+			entry.UpdatedAt = preview.Timestamp
+		}
+
+		if summary := summaries[membership.Key]; summary != nil {
+			entry.UnreadCount = summary.UnreadCount
+			entry.Muted = summary.Muted
+			entry.Pinned = summary.Pinned
+			entry.PinnedAt = summary.PinnedAt
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Pinned != entries[j].Pinned {
+			return entries[i].Pinned
+		}
+		// 置顶的会话按置顶时间倒序
+		if entries[i].Pinned && entries[i].PinnedAt != nil && entries[j].PinnedAt != nil &&
+			!entries[i].PinnedAt.Equal(*entries[j].PinnedAt) {
+			return entries[i].PinnedAt.After(*entries[j].PinnedAt)
+		}
+		return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"conversations": entries})
+}
+
+// UpdateConversation 更新会话的免打扰和置顶设置
+func UpdateConversation(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	targetIDStr := c.Param("targetId")
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	var req UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	conversationType := c.Param("type")
+	var conversationKey string
+	switch conversationType {
+	case models.MessageTypePrivate:
+		if err := checkFriend(uint(userID), uint(targetID)); err != nil {
+			respondError(c, err)
+			return
+		}
+		conversationKey = models.PrivateConversationKey(uint(userID), uint(targetID))
+	case models.MessageTypeGroup:
+		if _, _, err := checkGroupMember(uint(targetID), uint(userID)); err != nil {
+			respondError(c, err)
+			return
+		}
+		conversationKey = models.GroupConversationKey(uint(targetID))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话类型"})
+		return
+	}
+
+	conversation, err := models.UpdateConversationSettings(uint(userID), conversationKey, conversationType, req.Muted, req.Pinned)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新会话设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversation": conversation})
+}
+
+// getVisibleLastMessageIDs 获取每个会话中对用户可见的最后一条消息。会话记录的最后一条消息对所有成员相同，
+// 被该用户删除或因屏蔽对其隐藏时，需要查找该用户能看到的上一条消息，避免会话列表显示看不到的内容
+func getVisibleLastMessageIDs(userID uint, conversations map[string]*models.Conversation) (map[string]uint, error) {
+	lastMessageIDs := make(map[string]uint, len(conversations))
+	ids := make([]uint, 0, len(conversations))
+	for key, conversation := range conversations {
+		if conversation.LastMessageID != 0 {
+			lastMessageIDs[key] = conversation.LastMessageID
+			ids = append(ids, conversation.LastMessageID)
+		}
+	}
+
+	hidden, err := models.GetHiddenMessageIDs(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var hiddenKeys []string
+	for key, id := range lastMessageIDs {
+		if hidden[id] {
+			hiddenKeys = append(hiddenKeys, key)
+			delete(lastMessageIDs, key)
+		}
+	}
+
+	visible, err := models.GetLastVisibleMessageIDs(userID, hiddenKeys)
+	if err != nil {
+		return nil, err
+	}
+	for key, id := range visible {
+		lastMessageIDs[key] = id
+	}
+	return lastMessageIDs, nil
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// GetDevices 获取当前用户在线的设备列表
+func GetDevices(c *gin.Context) {
+	userID := c.GetString("userId")
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	c.JSON(http.StatusOK, gin.H{"devices": hub.UserDevices(userID)})
+}
+
+// CloseDevice 断开当前用户指定设备的WebSocket连接
+func CloseDevice(c *gin.Context) {
+	userID := c.GetString("userId")
+	deviceID := c.Param("deviceId")
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	if hub.CloseDevice(userID, deviceID) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不在线"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "设备已下线"})
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// 用户搜索的参数限制
+const (
+	maxUserKeywordLength   = 50
+	defaultUserSearchLimit = 20
+	maxUserSearchLimit     = 50
+)
+
+// UpdatePrivacyRequest 更新隐私设置请求，为空的字段保持不变
+type UpdatePrivacyRequest struct {
+	FindByUsername string `json:"findByUsername"` // everyone, contacts, nobody
+	FindByEmail    string `json:"findByEmail"`
+}
+
+// SearchUsers 搜索用户。关键词包含"@"时按邮箱精确查找，否则按用户名和昵称模糊匹配，
+// 结果遵守每个用户的隐私设置，屏蔽了自己的用户不会出现在结果中
+func SearchUsers(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	keyword := strings.TrimSpace(c.Query("keyword"))
+	if keyword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入搜索关键词"})
+		return
+	}
+	if utf8.RuneCountInString(keyword) > maxUserKeywordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "搜索关键词过长"})
+		return
+	}
+
+	limit := defaultUserSearchLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页大小"})
+			return
+		}
+		limit = l
+	}
+	if limit > maxUserSearchLimit {
+		limit = maxUserSearchLimit
+	}
+
+	offset := 0
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		o, err := strconv.Atoi(offsetStr)
+		if err != nil || o < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页游标"})
+			return
+		}
+		offset = o
+	}
+
+	contacts, contactIDs, err := getContactSet(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索用户失败"})
+		return
+	}
+
+	var users []*models.User
+	if strings.Contains(keyword, "@") {
+		users = findUserByEmail(uint(userID), keyword, contacts)
+	} else {
+		// 多取一条用于判断是否还有下一页
+		users, err = models.SearchUsers(uint(userID), keyword, contactIDs, offset, limit+1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索用户失败"})
+			return
+		}
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+
+	friends, err := getFriendSet(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索用户失败"})
+		return
+	}
+	items := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		items = append(items, publicProfile(user, friends[user.ID]))
+	}
+
+	var nextOffset int
+	if hasMore {
+		nextOffset = offset + limit
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":      items,
+		"hasMore":    hasMore,
+		"nextOffset": nextOffset,
+	})
+}
+
+// GetPublicProfile 获取其他用户的公开资料。
+// 好友和同群成员总是可以查看，其他人需要对方允许通过用户名搜索到自己
+func GetPublicProfile(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	targetIDStr := c.Param("id")
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	user, err := models.GetUserByID(uint(targetID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	// 屏蔽了自己的用户与不存在的用户无法区分
+	blocked, err := models.IsBlocked(user.ID, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户资料失败"})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if err := checkUserVisible(uint(userID), user); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	friend, err := isFriend(uint(userID), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户资料失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": publicProfile(user, friend)})
+}
+
+// UpdatePrivacySettings 更新当前用户的隐私设置
+func UpdatePrivacySettings(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req UpdatePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user, err := models.GetUserByID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if req.FindByUsername != "" {
+		if !models.ValidPrivacy(req.FindByUsername) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的隐私设置"})
+			return
+		}
+		user.FindByUsername = req.FindByUsername
+	}
+	if req.FindByEmail != "" {
+		if !models.ValidPrivacy(req.FindByEmail) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的隐私设置"})
+			return
+		}
+		user.FindByEmail = req.FindByEmail
+	}
+
+	if err := models.UpdateUserPrivacy(user.ID, user.FindByUsername, user.FindByEmail); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新隐私设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "隐私设置已更新",
+		"privacy": gin.H{
+			"findByUsername": user.FindByUsername,
+			"findByEmail":    user.FindByEmail,
+		},
+	})
+}
+
+// checkUserVisible 检查viewer能否找到用户：好友和同群成员总是可以，其他人需要对方允许通过用户名搜索到自己。
+// 不可见时与用户不存在返回相同的错误
+func checkUserVisible(viewerID uint, user *models.User) error {
+	if user.ID == viewerID {
+		return nil
+	}
+	if models.AllowsFinder(user.FindByUsername, false) {
+		return nil
+	}
+
+	contacts, _, err := getContactSet(viewerID)
+	if err != nil {
+		return newRequestError(http.StatusInternalServerError, "服务器错误")
+	}
+	if !contacts[user.ID] {
+		return newRequestError(http.StatusNotFound, "用户不存在")
+	}
+	return nil
+}
+
+// findUserByEmail 按邮箱精确查找用户，对方的隐私设置不允许或屏蔽了自己时返回空结果
+func findUserByEmail(viewerID uint, email string, contacts map[uint]bool) []*models.User {
+	users := make([]*models.User, 0, 1)
+	user, err := models.GetUserByEmail(email)
+	if err != nil || user.ID == viewerID || !models.AllowsFinder(user.FindByEmail, contacts[user.ID]) {
+		return users
+	}
+	if blocked, err := models.IsBlocked(user.ID, viewerID); err != nil || blocked {
+		return users
+	}
+	return append(users, user)
+}
+
+// getContactSet 获取用户的好友和同群成员
+func getContactSet(userID uint) (map[uint]bool, []uint, error) {
+	ids, err := models.GetRelatedUserIDs(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	contacts := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		contacts[id] = true
+	}
+	return contacts, ids, nil
+}
+
+// getFriendSet 获取用户的全部好友
+func getFriendSet(userID uint) (map[uint]bool, error) {
+	friendships, err := models.GetFriendships(userID, models.FriendshipAccepted)
+	if err != nil {
+		return nil, err
+	}
+	friends := make(map[uint]bool, len(friendships))
+	for _, friendship := range friendships {
+		friends[otherParty(friendship, userID)] = true
+	}
+	return friends, nil
+}
+
+// publicProfile 其他用户可以看到的资料，不包含邮箱；在线状态只对好友可见
+func publicProfile(user *models.User, friend bool) gin.H {
+	profile := gin.H{
+		"id":        user.ID,
+		"username":  user.Username,
+		"nickname":  user.Nickname,
+		"avatar":    user.Avatar,
+		"bio":       user.Bio,
+		"gender":    user.Gender,
+		"birthday":  user.Birthday,
+		"region":    user.Region,
+		"signature": user.Signature,
+		"isFriend":  friend,
+		"createdAt": user.CreatedAt,
+	}
+	if friend {
+		profile["status"] = user.Status
+		profile["lastSeenAt"] = user.LastSeenAt
+	}
+	return profile
+}
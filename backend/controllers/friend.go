@@ -1,19 +1,26 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
 	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
 )
 
 // AddFriendRequest 添加好友请求
 type AddFriendRequest struct {
-	FriendId string `json:"friendId" binding:"required"`
+	FriendId string `json:"friendId"` // 对方的用户名
+	UserID   uint   `json:"userId"`   // 对方的用户ID，例如从用户搜索结果中添加，与friendId二选一
+	Greeting string `json:"greeting"` // 附言，可选
 }
 
-// GetFriends 获取好友列表
+// GetFriends 获取好友列表，包含自己设置的备注名、标签和星标，星标好友排在前面。
+// 可以通过tag参数只获取某个标签下的好友，starred=true只获取星标好友
 func GetFriends(c *gin.Context) {
 	userIDStr := c.GetString("userId")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
@@ -29,8 +36,18 @@ func GetFriends(c *gin.Context) {
 		return
 	}
 
-	// 构建好友列表响应
+	settings, err := models.GetFriendSettings(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友列表失败"})
+		return
+	}
+	tag := c.Query("tag")
+	starredOnly := c.Query("starred") == "true"
+
+	// 构建好友列表响应，屏蔽了自己的好友显示为离线
+	blockers := getBlockerSet(uint(userID))
 	friends := make([]gin.H, 0)
+	starredCount := 0
 	for _, friendship := range friendships {
 		var friendID uint
 		if friendship.UserID == uint(userID) {
@@ -39,24 +56,50 @@ func GetFriends(c *gin.Context) {
 			friendID = friendship.UserID
 		}
 
+		setting := settings[friendID]
+		if setting == nil {
+			setting = &models.FriendSetting{FriendID: friendID, Tags: []string{}}
+		}
+		if (tag != "" && !hasTag(setting.Tags, tag)) || (starredOnly && !setting.Starred) {
+			continue
+		}
+
 		// 获取好友信息
 		friend, err := models.GetUserByID(friendID)
 		if err != nil {
 			continue // 跳过无法获取的好友
 		}
 
-		friends = append(friends, gin.H{
-			"id":       friend.ID,
-			"username": friend.Username,
-			"avatar":   friend.Avatar,
-			"status":   friend.Status,
-		})
+		status, lastSeenAt := visiblePresence(friend, blockers)
+		item := gin.H{
+			"id":          friend.ID,
+			"username":    friend.Username,
+			"nickname":    friend.Nickname,
+			"alias":       setting.Alias,
+			"displayName": displayName(friend, setting.Alias),
+			"avatar":      friend.Avatar,
+			"signature":   friend.Signature,
+			"tags":        setting.Tags,
+			"starred":     setting.Starred,
+			"status":      status,
+			"lastSeenAt":  lastSeenAt,
+		}
+		if setting.Starred {
+			// 星标好友插入到已有星标好友之后
+			friends = append(friends, nil)
+			copy(friends[starredCount+1:], friends[starredCount:])
+			friends[starredCount] = item
+			starredCount++
+		} else {
+			friends = append(friends, item)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"friends": friends})
 }
 
-// AddFriend 添加好友
+// AddFriend 发送好友请求，对方接受后才成为好友。
+// 对方已经向自己发出请求时直接成为好友
 func AddFriend(c *gin.Context) {
 	userIDStr := c.GetString("userId")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
@@ -70,47 +113,90 @@ func AddFriend(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
 		return
 	}
+	if utf8.RuneCountInString(req.Greeting) > maxGreetingLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "附言过长"})
+		return
+	}
 
-	// 查找要添加的用户 - 前端发送的是用户名，不是ID
-	friend, err := models.GetUserByUsername(req.FriendId)
+	// 查找要添加的用户，旧版前端发送的是用户名
+	var friend *models.User
+	switch {
+	case req.UserID != 0:
+		friend, err = models.GetUserByID(req.UserID)
+	case req.FriendId != "":
+		friend, err = models.GetUserByUsername(req.FriendId)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
 
+	// 对方的隐私设置不允许被搜索到时，与用户不存在无法区分
+	if err := checkUserVisible(uint(userID), friend); err != nil {
+		respondError(c, err)
+		return
+	}
+
 	// 不能添加自己为好友
 	if friend.ID == uint(userID) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "不能添加自己为好友"})
 		return
 	}
 
-	// 添加好友关系
-	friendship, err := models.AddFriend(uint(userID), friend.ID)
+	// 屏蔽了对方时不能发送请求；被对方屏蔽时请求照常创建，但对方看不到
+	shadow, err := checkBlockedPeer(uint(userID), friend.ID)
 	if err != nil {
-		if err.Error() == "好友关系已存在" {
-			c.JSON(http.StatusConflict, gin.H{"error": "已经是好友或好友请求已发送"})
-		} else {
+		respondError(c, err)
+		return
+	}
+
+	// 发送好友请求
+	friendship, err := models.AddFriend(uint(userID), friend.ID, req.Greeting,
+		config.AppConfig.Friend.RequestTTL, config.AppConfig.Friend.RejectCooldown)
+	if err != nil {
+		switch err {
+		case models.ErrAlreadyFriends:
+			c.JSON(http.StatusConflict, gin.H{"error": "已经是好友"})
+		case models.ErrFriendRequestPending:
+			c.JSON(http.StatusConflict, gin.H{"error": "好友请求已发送，请等待对方处理"})
+		case models.ErrFriendRequestCooldown:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试"})
+		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "添加好友失败: " + err.Error()})
 		}
 		return
 	}
 
-	// 简化处理，直接设为已接受
-	friendship.Status = "accepted"
-	err = models.UpdateFriendship(friendship)
+	user, err := models.GetUserByID(uint(userID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新好友关系失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
 		return
 	}
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	// 对方之前发出的请求被自动接受
+	if friendship.Status == models.FriendshipAccepted {
+		notifyFriendRequestAccepted(hub, friendship, friend, user)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "好友添加成功",
+			"friend":  friendInfo(friend),
+		})
+		return
+	}
+
+	if !shadow {
+		pushToUser(hub, friend.ID, map[string]interface{}{
+			"type":    "friend_request",
+			"request": friendRequestItem(friendship, user),
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "好友添加成功",
-		"friend": gin.H{
-			"id":       friend.ID,
-			"username": friend.Username,
-			"avatar":   friend.Avatar,
-			"status":   friend.Status,
-		},
+		"message": "好友请求已发送",
+		"request": friendRequestItem(friendship, friend),
 	})
 }
 
@@ -130,8 +216,8 @@ func RemoveFriend(c *gin.Context) {
 		return
 	}
 
-	// 获取所有好友关系
-	friendships, err := models.GetFriendships(uint(userID), "")
+	// 获取所有好友关系，未处理的好友请求通过撤销或拒绝处理
+	friendships, err := models.GetFriendships(uint(userID), models.FriendshipAccepted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友关系失败"})
 		return
@@ -159,5 +245,10 @@ func RemoveFriend(c *gin.Context) {
 		return
 	}
 
+	// 备注名和标签只在好友关系存在时有意义，重新添加好友后需要重新设置
+	if err := models.DeleteFriendSettings(uint(userID), uint(friendID)); err != nil {
+		log.Printf("删除好友设置失败: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "好友已删除"})
 }
\ No newline at end of file
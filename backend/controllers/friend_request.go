@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// maxGreetingLength 好友请求附言的最大字符数
+const maxGreetingLength = 100
+
+// friendRequestExpiryInterval 标记过期好友请求的间隔
+const friendRequestExpiryInterval = time.Hour
+
+// GetIncomingFriendRequests 获取别人发给自己、等待处理的好友请求
+func GetIncomingFriendRequests(c *gin.Context) {
+	listFriendRequests(c, true)
+}
+
+// GetOutgoingFriendRequests 获取自己发出、等待对方处理的好友请求
+func GetOutgoingFriendRequests(c *gin.Context) {
+	listFriendRequests(c, false)
+}
+
+// listFriendRequests 返回好友请求列表，每个请求附带对方的用户信息
+func listFriendRequests(c *gin.Context, incoming bool) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	requests, err := models.GetFriendRequests(uint(userID), incoming)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友请求失败"})
+		return
+	}
+
+	otherIDs := make([]uint, 0, len(requests))
+	for _, request := range requests {
+		otherIDs = append(otherIDs, otherParty(request, uint(userID)))
+	}
+	users, err := models.GetUsersByIDs(otherIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友请求失败"})
+		return
+	}
+	usersByID := make(map[uint]*models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	items := make([]gin.H, 0, len(requests))
+	for _, request := range requests {
+		other, ok := usersByID[otherParty(request, uint(userID))]
+		if !ok {
+			continue // 跳过已注销的用户
+		}
+		items = append(items, friendRequestItem(request, other))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": items})
+}
+
+// AcceptFriendRequest 接受好友请求，双方成为好友
+func AcceptFriendRequest(c *gin.Context) {
+	userID, request, ok := loadFriendRequest(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.RespondFriendRequest(request, true); err != nil {
+		respondFriendRequestError(c, err)
+		return
+	}
+
+	accepter, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+	requester, err := models.GetUserByID(request.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	notifyFriendRequestAccepted(hub, request, requester, accepter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已添加好友",
+		"friend":  friendInfo(requester),
+	})
+}
+
+// RejectFriendRequest 拒绝好友请求，请求者之后可以重新发送
+func RejectFriendRequest(c *gin.Context) {
+	_, request, ok := loadFriendRequest(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.RespondFriendRequest(request, false); err != nil {
+		respondFriendRequestError(c, err)
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	event := map[string]interface{}{
+		"type":      "friend_request_rejected",
+		"requestId": request.ID,
+	}
+	pushToUser(hub, request.UserID, event)
+	pushToUser(hub, request.FriendID, event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已拒绝好友请求"})
+}
+
+// CancelFriendRequest 撤销自己发出的好友请求
+func CancelFriendRequest(c *gin.Context) {
+	_, request, ok := loadFriendRequest(c, false)
+	if !ok {
+		return
+	}
+
+	if err := models.CancelFriendRequest(request); err != nil {
+		respondFriendRequestError(c, err)
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	event := map[string]interface{}{
+		"type":      "friend_request_cancelled",
+		"requestId": request.ID,
+	}
+	pushToUser(hub, request.FriendID, event)
+	pushToUser(hub, request.UserID, event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已撤销好友请求"})
+}
+
+// StartFriendRequestExpiry 启动后台任务，定期将超时未处理的好友请求标记为过期。
+// 查询时同样会过滤已过期的请求，这里只负责更新状态
+func StartFriendRequestExpiry() {
+	go func() {
+		ticker := time.NewTicker(friendRequestExpiryInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := models.ExpireFriendRequests(); err != nil {
+				log.Printf("标记过期好友请求失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// loadFriendRequest 读取路径中的好友请求，asRecipient为true时要求当前用户是接收者，否则要求是发送者。
+// 失败时已写入响应
+func loadFriendRequest(c *gin.Context, asRecipient bool) (uint, *models.Friendship, bool) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return 0, nil, false
+	}
+
+	requestIDStr := c.Param("id")
+	requestID, err := strconv.ParseUint(requestIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的好友请求ID"})
+		return 0, nil, false
+	}
+
+	request, err := models.GetFriendRequestByID(uint(requestID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "好友请求不存在"})
+		return 0, nil, false
+	}
+	ownerID := request.UserID
+	if asRecipient {
+		ownerID = request.FriendID
+	}
+	if ownerID != uint(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "好友请求不存在"})
+		return 0, nil, false
+	}
+	if !request.IsPendingRequest() {
+		respondFriendRequestError(c, models.ErrFriendRequestNotPending)
+		return 0, nil, false
+	}
+	return uint(userID), request, true
+}
+
+// respondFriendRequestError 将处理好友请求时的错误写入响应
+func respondFriendRequestError(c *gin.Context, err error) {
+	if err == models.ErrFriendRequestNotPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "好友请求已处理或已过期"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "处理好友请求失败"})
+}
+
+// notifyFriendRequestAccepted 通知双方已成为好友，friend为对方的信息
+func notifyFriendRequestAccepted(hub *websocket.Hub, request *models.Friendship, requester, accepter *models.User) {
+	pushToUser(hub, requester.ID, map[string]interface{}{
+		"type":      "friend_request_accepted",
+		"requestId": request.ID,
+		"friend":    friendInfo(accepter),
+	})
+	pushToUser(hub, accepter.ID, map[string]interface{}{
+		"type":      "friend_request_accepted",
+		"requestId": request.ID,
+		"friend":    friendInfo(requester),
+	})
+}
+
+// otherParty 好友关系中另一方的用户ID
+func otherParty(friendship *models.Friendship, userID uint) uint {
+	if friendship.UserID == userID {
+		return friendship.FriendID
+	}
+	return friendship.UserID
+}
+
+// friendInfo 好友列表中的用户信息
+func friendInfo(user *models.User) gin.H {
+	return gin.H{
+		"id":         user.ID,
+		"username":   user.Username,
+		"avatar":     user.Avatar,
+		"status":     user.Status,
+		"lastSeenAt": user.LastSeenAt,
+	}
+}
+
+// friendRequestItem 好友请求的响应，user为对方的公开信息，在成为好友前不包含在线状态
+func friendRequestItem(request *models.Friendship, other *models.User) gin.H {
+	return gin.H{
+		"id":         request.ID,
+		"fromUserId": request.UserID,
+		"toUserId":   request.FriendID,
+		"greeting":   request.Greeting,
+		"status":     request.Status,
+		"createdAt":  request.CreatedAt,
+		"expiresAt":  request.ExpiresAt,
+		"user": gin.H{
+			"id":       other.ID,
+			"username": other.Username,
+			"avatar":   other.Avatar,
+		},
+	}
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+const (
+	maxAliasLength = 50 // 备注名的最大字符数
+	maxFriendTags  = 20 // 每个好友最多的标签数
+	maxTagLength   = 20 // 标签的最大字符数
+)
+
+// UpdateFriendSettingsRequest 更新好友设置请求，未提供的字段保持不变
+type UpdateFriendSettingsRequest struct {
+	Alias   *string   `json:"alias"` // 为空字符串时清除备注
+	Tags    *[]string `json:"tags"`  // 完整的标签列表，为空数组时清除全部标签
+	Starred *bool     `json:"starred"`
+}
+
+// UpdateFriendSettings 更新对好友的备注名、分组标签和星标，只对自己可见
+func UpdateFriendSettings(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	friendIDStr := c.Param("id")
+	friendID, err := strconv.ParseUint(friendIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的好友ID"})
+		return
+	}
+
+	var req UpdateFriendSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	if req.Alias != nil {
+		alias := strings.TrimSpace(*req.Alias)
+		if utf8.RuneCountInString(alias) > maxAliasLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "备注名过长"})
+			return
+		}
+		req.Alias = &alias
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		req.Tags = &tags
+	}
+
+	if err := checkFriend(uint(userID), uint(friendID)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setting, err := models.UpdateFriendSettings(uint(userID), uint(friendID), req.Alias, req.Tags, req.Starred)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新好友设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": setting})
+}
+
+// GetFriendTags 获取自己使用过的全部好友标签及每个标签下的好友数，按名称排序
+func GetFriendTags(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	settings, err := models.GetFriendSettings(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友标签失败"})
+		return
+	}
+	friendIDs, err := getFriendSet(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友标签失败"})
+		return
+	}
+
+	counts := make(map[string]int)
+	for friendID, setting := range settings {
+		if !friendIDs[friendID] {
+			continue
+		}
+		for _, tag := range setting.Tags {
+			counts[tag]++
+		}
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tags := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, gin.H{"name": name, "count": counts[name]})
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// normalizeTags 去掉标签两端的空白、空标签和重复的标签，并检查数量和长度
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, newRequestError(http.StatusBadRequest, "标签过长")
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxFriendTags {
+		return nil, newRequestError(http.StatusBadRequest, "标签过多")
+	}
+	return result, nil
+}
+
+// hasTag 标签列表中是否包含指定标签
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// displayName 用户的显示名称：优先使用查看者设置的备注名，其次是昵称，最后是用户名
+func displayName(user *models.User, alias string) string {
+	if alias != "" {
+		return alias
+	}
+	if user.Nickname != "" {
+		return user.Nickname
+	}
+	return user.Username
+}
+
+// pushMessageEvent 推送消息事件，为给发送者设置了备注名的接收者替换事件中的发送者显示名称
+func pushMessageEvent(hub *websocket.Hub, senderID uint, recipientIDs []uint, event map[string]interface{}) {
+	aliases, err := models.GetAliasesForFriend(senderID, recipientIDs)
+	if err != nil {
+		log.Printf("获取好友备注失败: %v", err)
+	}
+	for _, recipientID := range recipientIDs {
+		if alias, ok := aliases[recipientID]; ok {
+			pushToUser(hub, recipientID, withSenderAlias(event, alias))
+		} else {
+			pushToUser(hub, recipientID, event)
+		}
+	}
+}
+
+// withSenderAlias 复制消息事件并在发送者信息中加入备注名，事件会推送给多个用户，不能直接修改
+func withSenderAlias(event map[string]interface{}, alias string) map[string]interface{} {
+	message, ok := event["message"].(map[string]interface{})
+	if !ok {
+		return event
+	}
+	sender, ok := message["sender"].(map[string]interface{})
+	if !ok {
+		return event
+	}
+
+	senderCopy := make(map[string]interface{}, len(sender)+1)
+	for k, v := range sender {
+		senderCopy[k] = v
+	}
+	senderCopy["alias"] = alias
+	senderCopy["displayName"] = alias
+
+	messageCopy := make(map[string]interface{}, len(message))
+	for k, v := range message {
+		messageCopy[k] = v
+	}
+	messageCopy["sender"] = senderCopy
+
+	eventCopy := make(map[string]interface{}, len(event))
+	for k, v := range event {
+		eventCopy[k] = v
+	}
+	eventCopy["message"] = messageCopy
+	return eventCopy
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tooMany := make([]string, maxFriendTags+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("t", i+1)
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", nil, []string{}, false},
+		{"trims spaces", []string{" 同事 ", "家人"}, []string{"同事", "家人"}, false},
+		{"drops blank and duplicates", []string{"a", "", "  ", "a", " a"}, []string{"a"}, false},
+		{"max length", []string{strings.Repeat("标", maxTagLength)}, []string{strings.Repeat("标", maxTagLength)}, false},
+		{"too long", []string{strings.Repeat("标", maxTagLength+1)}, nil, true},
+		{"max count", tooMany[:maxFriendTags], tooMany[:maxFriendTags], false},
+		{"too many", tooMany, nil, true},
+		{"duplicates do not count", append(tooMany[:maxFriendTags:maxFriendTags], tooMany[0]), tooMany[:maxFriendTags], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.tags)
+			if tt.wantErr {
+				var reqErr *requestError
+				if !errors.As(err, &reqErr) || reqErr.Status != http.StatusBadRequest {
+					t.Fatalf("err = %v, want bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+const (
+	defaultSuggestionLimit = 10  // 默认返回的推荐数
+	maxSuggestionLimit     = 50  // 单次最多返回的推荐数
+	suggestionCandidates   = 200 // 每个用户缓存的候选数，需要多于返回数以便过滤后仍有足够结果
+
+	// suggestionCleanupInterval 清理过期推荐缓存的间隔
+	suggestionCleanupInterval = 10 * time.Minute
+)
+
+// suggestionEntry 一个用户的推荐候选缓存
+type suggestionEntry struct {
+	candidates []*models.FriendSuggestion
+	expiresAt  time.Time
+}
+
+// suggestionCache 按用户缓存计算好的推荐候选，过期后在下次请求时重新计算
+var suggestionCache = struct {
+	sync.Mutex
+	entries map[uint]*suggestionEntry
+}{entries: make(map[uint]*suggestionEntry)}
+
+// GetFriendSuggestions 获取好友推荐，按共同好友和共同群组排序。
+// 已经是好友、有未处理的好友请求、任一方屏蔽了对方以及忽略过的用户不会出现在推荐中
+func GetFriendSuggestions(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	limit := defaultSuggestionLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页大小"})
+			return
+		}
+		limit = l
+	}
+	if limit > maxSuggestionLimit {
+		limit = maxSuggestionLimit
+	}
+
+	excluded, err := models.GetSuggestionExclusions(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友推荐失败"})
+		return
+	}
+	candidates, err := getSuggestionCandidates(uint(userID), excluded)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友推荐失败"})
+		return
+	}
+
+	// 缓存的候选可能在缓存期内被排除或不允许被推荐，按批次查询用户直到凑满一页或候选用完
+	suggestions := make([]gin.H, 0, limit)
+	for start := 0; start < len(candidates) && len(suggestions) < limit; {
+		batch := make([]*models.FriendSuggestion, 0, limit)
+		for ; start < len(candidates) && len(batch) < limit; start++ {
+			if !excluded[candidates[start].UserID] {
+				batch = append(batch, candidates[start])
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		ids := make([]uint, 0, len(batch))
+		for _, candidate := range batch {
+			ids = append(ids, candidate.UserID)
+		}
+		users, err := models.GetUsersByIDs(ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取好友推荐失败"})
+			return
+		}
+		byID := make(map[uint]*models.User, len(users))
+		for _, user := range users {
+			byID[user.ID] = user
+		}
+
+		for _, candidate := range batch {
+			if len(suggestions) >= limit {
+				break
+			}
+			user, ok := byID[candidate.UserID]
+			if !ok {
+				continue
+			}
+			// 同群成员属于联系人，只通过共同好友推荐的用户需要允许所有人搜索到自己
+			if !models.AllowsFinder(user.FindByUsername, candidate.SharedGroups > 0) {
+				continue
+			}
+			suggestions = append(suggestions, gin.H{
+				"user":          publicProfile(user, false),
+				"mutualFriends": candidate.MutualFriends,
+				"sharedGroups":  candidate.SharedGroups,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// DismissFriendSuggestion 忽略好友推荐，之后不会再推荐该用户
+func DismissFriendSuggestion(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	targetIDStr := c.Param("userId")
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil || targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if _, err := models.GetUserByID(uint(targetID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if err := models.DismissFriendSuggestion(uint(userID), uint(targetID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "忽略推荐失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已忽略该推荐"})
+}
+
+// StartFriendSuggestionCleanup 启动后台任务，定期清理过期的推荐缓存，避免不再活跃的用户占用内存
+func StartFriendSuggestionCleanup() {
+	go func() {
+		ticker := time.NewTicker(suggestionCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			suggestionCache.Lock()
+			for userID, entry := range suggestionCache.entries {
+				if now.After(entry.expiresAt) {
+					delete(suggestionCache.entries, userID)
+				}
+			}
+			suggestionCache.Unlock()
+		}
+	}()
+}
+
+// getSuggestionCandidates 获取用户的推荐候选，缓存过期时重新计算，计算时先去掉excluded中的用户再截取。
+// 候选在缓存期内不会反映新的共同好友和群组，排除条件仍需在每次请求时按最新数据过滤
+func getSuggestionCandidates(userID uint, excluded map[uint]bool) ([]*models.FriendSuggestion, error) {
+	now := time.Now()
+	suggestionCache.Lock()
+	entry, ok := suggestionCache.entries[userID]
+	suggestionCache.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.candidates, nil
+	}
+
+	candidates, err := models.ComputeFriendSuggestions(userID, excluded, suggestionCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestionCache.Lock()
+	suggestionCache.entries[userID] = &suggestionEntry{
+		candidates: candidates,
+		expiresAt:  now.Add(config.AppConfig.Friend.SuggestionTTL),
+	}
+	suggestionCache.Unlock()
+	return candidates, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
 )
 
 // CreateGroupRequest 创建群组请求
@@ -17,9 +18,14 @@ type CreateGroupRequest struct {
 
 // UpdateGroupRequest 更新群组请求
 type UpdateGroupRequest struct {
-	Name        string `json:"name" binding:"omitempty,min=2,max=100"`
-	Description string `json:"description"`
-	Avatar      string `json:"avatar"`
+	Name        string  `json:"name" binding:"omitempty,min=2,max=100"`
+	Description *string `json:"description"` // 未提供时保持不变，为空字符串时清除群介绍
+	Avatar      string  `json:"avatar"`
+}
+
+// TransferGroupRequest 转让群主请求
+type TransferGroupRequest struct {
+	UserID uint `json:"userId" binding:"required"`
 }
 
 // AddGroupMemberRequest 添加群组成员请求
@@ -96,6 +102,14 @@ func CreateGroup(c *gin.Context) {
 		return
 	}
 
+	if creator, err := models.GetUserByID(uint(userID)); err == nil {
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		postGroupSystemMessage(hub, group.ID, creator, &models.SystemPayload{
+			Event:      models.SystemEventGroupCreated,
+			OperatorID: creator.ID,
+		})
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "群组创建成功",
 		"group": gin.H{
@@ -215,10 +229,13 @@ func UpdateGroup(c *gin.Context) {
 	}
 
 	// 更新群组信息
+	previous := *group
 	if req.Name != "" {
 		group.Name = req.Name
 	}
-	group.Description = req.Description
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
 	if req.Avatar != "" {
 		group.Avatar = req.Avatar
 	}
@@ -229,6 +246,32 @@ func UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	// 在群聊中通知修改的内容
+	if operator, err := models.GetUserByID(uint(userID)); err == nil {
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		if group.Name != previous.Name {
+			postGroupSystemMessage(hub, group.ID, operator, &models.SystemPayload{
+				Event:      models.SystemEventGroupRenamed,
+				OperatorID: operator.ID,
+				Value:      group.Name,
+			})
+		}
+		if group.Description != previous.Description {
+			postGroupSystemMessage(hub, group.ID, operator, &models.SystemPayload{
+				Event:      models.SystemEventDescriptionChanged,
+				OperatorID: operator.ID,
+				Value:      group.Description,
+			})
+		}
+		if group.Avatar != previous.Avatar {
+			postGroupSystemMessage(hub, group.ID, operator, &models.SystemPayload{
+				Event:      models.SystemEventAvatarChanged,
+				OperatorID: operator.ID,
+				Value:      group.Avatar,
+			})
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "群组更新成功",
 		"group": gin.H{
@@ -269,27 +312,31 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
-	// 删除群组成员
 	members, err := models.GetGroupMembers(uint(groupID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取群组成员失败"})
 		return
 	}
 
-	for _, member := range members {
-		err = models.RemoveGroupMember(uint(groupID), member.UserID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除群组成员失败"})
-			return
-		}
-	}
-
-	// 删除群组
+	// 删除群组、成员和群聊的会话记录
 	err = models.DeleteGroup(uint(groupID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除群组失败"})
 		return
 	}
+	conversationKey := models.GroupConversationKey(uint(groupID))
+	unindexConversation(conversationKey)
+
+	// 解散通知只推送不保存，群聊已经删除，不会再留下一条指向不存在群组的消息
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	for _, member := range members {
+		pushToUser(hub, member.UserID, map[string]interface{}{
+			"type":            "group_dissolved",
+			"groupId":         group.ID,
+			"conversationKey": conversationKey,
+			"operatorId":      uint(userID),
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "群组已删除"})
 }
@@ -331,7 +378,8 @@ func GetGroupMembers(c *gin.Context) {
 		return
 	}
 
-	// 构建成员列表响应
+	// 构建成员列表响应，屏蔽了自己的成员显示为离线
+	blockers := getBlockerSet(uint(userID))
 	memberList := make([]gin.H, 0)
 	for _, member := range members {
 		// 获取用户信息
@@ -340,12 +388,14 @@ func GetGroupMembers(c *gin.Context) {
 			continue // 跳过无法获取的用户
 		}
 
+		status, lastSeenAt := visiblePresence(user, blockers)
 		memberList = append(memberList, gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"avatar":   user.Avatar,
-			"status":   user.Status,
-			"role":     member.Role,
+			"id":         user.ID,
+			"username":   user.Username,
+			"avatar":     user.Avatar,
+			"status":     status,
+			"lastSeenAt": lastSeenAt,
+			"role":       member.Role,
 		})
 	}
 
@@ -402,6 +452,17 @@ func AddGroupMember(c *gin.Context) {
 		return
 	}
 
+	// 对方屏蔽了自己时不能邀请，与用户不存在无法区分，和查看资料、搜索用户时的处理一致
+	blocked, err := models.IsBlocked(user.ID, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加群组成员失败"})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
 	// 设置角色，默认为普通成员
 	role := "member"
 	if req.Role != "" {
@@ -419,14 +480,24 @@ func AddGroupMember(c *gin.Context) {
 		return
 	}
 
+	if operator, err := models.GetUserByID(uint(userID)); err == nil {
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		postGroupSystemMessage(hub, uint(groupID), operator, &models.SystemPayload{
+			Event:      models.SystemEventMemberAdded,
+			OperatorID: operator.ID,
+			UserIDs:    []uint{user.ID},
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "成员添加成功",
 		"member": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"avatar":   user.Avatar,
-			"status":   user.Status,
-			"role":     newMember.Role,
+			"id":         user.ID,
+			"username":   user.Username,
+			"avatar":     user.Avatar,
+			"status":     user.Status,
+			"lastSeenAt": user.LastSeenAt,
+			"role":       newMember.Role,
 		},
 	})
 }
@@ -503,6 +574,12 @@ func RemoveGroupMember(c *gin.Context) {
 		return
 	}
 
+	// 群主退出前需要先转让群组，否则群组将没有群主
+	if uint(memberID) == group.CreatorID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "群主需要先转让群组才能退出"})
+		return
+	}
+
 	// 移除成员
 	err = models.RemoveGroupMember(uint(groupID), uint(memberID))
 	if err != nil {
@@ -510,5 +587,86 @@ func RemoveGroupMember(c *gin.Context) {
 		return
 	}
 
+	// 主动退出和被移除使用不同的通知，被移除的成员也会收到通知
+	if operator, err := models.GetUserByID(uint(userID)); err == nil {
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		if uint(userID) == uint(memberID) {
+			postGroupSystemMessage(hub, uint(groupID), operator, &models.SystemPayload{
+				Event:      models.SystemEventMemberLeft,
+				OperatorID: operator.ID,
+			})
+		} else {
+			postGroupSystemMessage(hub, uint(groupID), operator, &models.SystemPayload{
+				Event:      models.SystemEventMemberRemoved,
+				OperatorID: operator.ID,
+				UserIDs:    []uint{uint(memberID)},
+			}, uint(memberID))
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// TransferGroup 转让群主，只有群主可以操作，新群主必须是群组成员
+func TransferGroup(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	groupIDStr := c.Param("id")
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	var req TransferGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	group, err := models.GetGroupByID(uint(groupID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "群组不存在"})
+		return
+	}
+
+	if group.CreatorID != uint(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有群主可以转让群组"})
+		return
+	}
+
+	if req.UserID == uint(userID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能转让给自己"})
+		return
+	}
+
+	// 新群主必须是群组成员
+	if _, _, err := checkGroupMember(uint(groupID), req.UserID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该用户不是群组成员"})
+		return
+	}
+
+	if err := models.TransferGroupOwner(uint(groupID), req.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转让群组失败"})
+		return
+	}
+
+	if operator, err := models.GetUserByID(uint(userID)); err == nil {
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		postGroupSystemMessage(hub, uint(groupID), operator, &models.SystemPayload{
+			Event:      models.SystemEventOwnerTransferred,
+			OperatorID: operator.ID,
+			UserIDs:    []uint{req.UserID},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "群组已转让",
+		"creatorId": req.UserID,
+	})
 }
\ No newline at end of file
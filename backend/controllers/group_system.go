@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// postGroupSystemMessage 在群聊时间线中写入系统通知，并推送给当前全部成员。
+// extraRecipients 为已经不在群里但需要收到通知的用户，例如被移除的成员
+func postGroupSystemMessage(hub *websocket.Hub, groupID uint, operator *models.User, payload *models.SystemPayload, extraRecipients ...uint) {
+	users, err := models.GetUsersByIDs(payload.UserIDs)
+	if err != nil {
+		log.Printf("获取系统通知相关用户失败: %v", err)
+	}
+	content := systemMessageSummary(payload, operator, users)
+
+	encoded, err := models.EncodeMessagePayload(payload)
+	if err != nil {
+		log.Printf("系统通知序列化失败: %v", err)
+		return
+	}
+	message, err := models.SaveGroupMessage(operator.ID, groupID, content, models.SaveMessageOptions{
+		Kind:    models.MessageKindSystem,
+		Payload: encoded,
+	})
+	if err != nil {
+		log.Printf("保存系统通知失败: %v", err)
+		return
+	}
+
+	members, err := models.GetGroupMembers(groupID)
+	if err != nil {
+		log.Printf("获取群组成员失败: %v", err)
+	}
+	seen := make(map[uint]bool)
+	recipients := make([]uint, 0, len(members)+len(extraRecipients))
+	for _, member := range members {
+		seen[member.UserID] = true
+		recipients = append(recipients, member.UserID)
+	}
+	for _, userID := range extraRecipients {
+		if !seen[userID] {
+			seen[userID] = true
+			recipients = append(recipients, userID)
+		}
+	}
+
+	// 操作者的其他设备也需要收到通知，但不需要投递记录
+	receiverIDs := make([]uint, 0, len(recipients))
+	for _, userID := range recipients {
+		if userID != operator.ID {
+			receiverIDs = append(receiverIDs, userID)
+		}
+	}
+	if err := models.CreateDeliveries(message.ID, receiverIDs); err != nil {
+		log.Printf("创建投递记录失败: %v", err)
+	}
+
+	pushMessageEvent(hub, operator.ID, recipients, buildGroupMessageEvent(message, operator))
+}
+
+// systemMessageSummary 系统通知的文字描述
+func systemMessageSummary(payload *models.SystemPayload, operator *models.User, users []*models.User) string {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	targets := strings.Join(names, "、")
+
+	switch payload.Event {
+	case models.SystemEventGroupCreated:
+		return fmt.Sprintf("%s 创建了群聊", operator.Username)
+	case models.SystemEventMemberAdded:
+		return fmt.Sprintf("%s 邀请 %s 加入了群聊", operator.Username, targets)
+	case models.SystemEventMemberRemoved:
+		return fmt.Sprintf("%s 将 %s 移出了群聊", operator.Username, targets)
+	case models.SystemEventMemberLeft:
+		return fmt.Sprintf("%s 退出了群聊", operator.Username)
+	case models.SystemEventGroupRenamed:
+		return fmt.Sprintf("%s 将群名称修改为 %s", operator.Username, payload.Value)
+	case models.SystemEventDescriptionChanged:
+		return fmt.Sprintf("%s 修改了群介绍", operator.Username)
+	case models.SystemEventAvatarChanged:
+		return fmt.Sprintf("%s 修改了群头像", operator.Username)
+	case models.SystemEventOwnerTransferred:
+		return fmt.Sprintf("%s 将群主转让给 %s", operator.Username, targets)
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// requestError 带HTTP状态码的业务错误，HTTP接口和WebSocket处理器共用
+type requestError struct {
+	Status  int
+	Message string
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// newRequestError 创建业务错误
+func newRequestError(status int, message string) *requestError {
+	return &requestError{Status: status, Message: message}
+}
+
+// respondError 将业务错误写入HTTP响应
+func respondError(c *gin.Context, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		c.JSON(reqErr.Status, gin.H{"error": reqErr.Message})
+		return
+	}
+	log.Printf("请求处理失败: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+}
+
+// toWSError 将业务错误转换为WebSocket协议错误
+func toWSError(err error) error {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+
+	code := websocket.ErrCodeInternal
+	switch reqErr.Status {
+	case http.StatusBadRequest:
+		code = websocket.ErrCodeBadRequest
+	case http.StatusForbidden:
+		code = websocket.ErrCodeForbidden
+	case http.StatusNotFound:
+		code = websocket.ErrCodeNotFound
+	}
+	return websocket.NewError(code, reqErr.Message)
+}
+
+// isFriend 检查两个用户之间是否存在已接受的好友关系
+func isFriend(userID, otherID uint) (bool, error) {
+	friendships, err := models.GetFriendships(userID, "accepted")
+	if err != nil {
+		return false, err
+	}
+
+	for _, friendship := range friendships {
+		if (friendship.UserID == userID && friendship.FriendID == otherID) ||
+			(friendship.UserID == otherID && friendship.FriendID == userID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkFriend 检查对方用户存在且双方是好友
+func checkFriend(userID, otherID uint) error {
+	if _, err := models.GetUserByID(otherID); err != nil {
+		return newRequestError(http.StatusNotFound, "用户不存在")
+	}
+
+	ok, err := isFriend(userID, otherID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newRequestError(http.StatusForbidden, "您不是该用户的好友")
+	}
+	return nil
+}
+
+// checkGroupMember 检查群组存在且用户是群组成员，返回该用户的成员信息和全部成员
+func checkGroupMember(groupID, userID uint) (*models.GroupMember, []*models.GroupMember, error) {
+	if _, err := models.GetGroupByID(groupID); err != nil {
+		return nil, nil, newRequestError(http.StatusNotFound, "群组不存在")
+	}
+
+	members, err := models.GetGroupMembers(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, member := range members {
+		if member.UserID == userID {
+			return member, members, nil
+		}
+	}
+	return nil, nil, newRequestError(http.StatusForbidden, "您不是该群组的成员")
+}
+
+// decorateMessages 为返回给用户的消息填充引用预览、@提及、已读人数和表情回应
+func decorateMessages(messages []*models.Message, viewerID uint) error {
+	if err := models.LoadReplyPreviews(messages); err != nil {
+		return err
+	}
+	if err := models.LoadMentions(messages); err != nil {
+		return err
+	}
+	if err := models.LoadReadCounts(messages); err != nil {
+		return err
+	}
+	if err := models.LoadAttachments(messages); err != nil {
+		return err
+	}
+	return models.LoadReactions(messages, viewerID)
+}
+
+// pushToUser 通过WebSocket向用户推送事件
+func pushToUser(hub *websocket.Hub, userID uint, event interface{}) bool {
+	jsonData, err := json.Marshal(gin.H{"data": event})
+	if err != nil {
+		log.Printf("消息序列化失败: %v", err)
+		return false
+	}
+	return hub.SendToUser(strconv.FormatUint(uint64(userID), 10), jsonData)
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/media"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/storage"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// maxAvatarSize 头像原图的最大字节数
+const maxAvatarSize = 5 << 20
+
+// RegisterMediaHandlers 注册图片处理完成后的推送
+func RegisterMediaHandlers(hub *websocket.Hub) {
+	media.OnAttachmentProcessed(attachmentProcessedHandler(hub))
+	media.OnAvatarProcessed(avatarProcessedHandler(hub))
+}
+
+// attachmentProcessedHandler 图片附件处理完成后通知上传者，已发送的附件同时通知会话成员
+func attachmentProcessedHandler(hub *websocket.Hub) func(*models.Attachment) {
+	return func(attachment *models.Attachment) {
+		recipients := []uint{attachment.UploaderID}
+		if attachment.MessageID != nil {
+			message, err := models.GetMessageByID(*attachment.MessageID)
+			if err == nil && !message.Recalled {
+				if participants, err := getConversationParticipants(message, message.SenderID); err == nil {
+					recipients = participants
+				}
+			}
+		}
+
+		event := map[string]interface{}{
+			"type":       "attachment_updated",
+			"attachment": attachment,
+		}
+		for _, recipientID := range recipients {
+			pushToUser(hub, recipientID, event)
+		}
+	}
+}
+
+// avatarProcessedHandler 头像处理完成后通知用户的好友和同群成员，群头像通知全部群成员
+func avatarProcessedHandler(hub *websocket.Hub) func(media.AvatarResult) {
+	return func(result media.AvatarResult) {
+		var recipients []uint
+		switch result.Target {
+		case media.AvatarTargetUser:
+			related, err := models.GetRelatedUserIDs(result.TargetID)
+			if err != nil {
+				log.Printf("获取头像更新的订阅者失败: %v", err)
+			}
+			recipients = append(related, result.TargetID)
+		case media.AvatarTargetGroup:
+			if operator, err := models.GetUserByID(result.OperatorID); err == nil {
+				postGroupSystemMessage(hub, result.TargetID, operator, &models.SystemPayload{
+					Event:      models.SystemEventAvatarChanged,
+					OperatorID: operator.ID,
+					Value:      result.Avatar,
+				})
+			}
+			members, err := models.GetGroupMembers(result.TargetID)
+			if err != nil {
+				log.Printf("获取群组成员失败: %v", err)
+				return
+			}
+			for _, member := range members {
+				recipients = append(recipients, member.UserID)
+			}
+		}
+
+		event := map[string]interface{}{
+			"type":     "avatar_updated",
+			"target":   result.Target,
+			"targetId": result.TargetID,
+			"avatar":   result.Avatar,
+		}
+		for _, recipientID := range recipients {
+			pushToUser(hub, recipientID, event)
+		}
+	}
+}
+
+// UploadUserAvatar 上传当前用户的头像，处理完成后推送avatar_updated事件
+func UploadUserAvatar(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	enqueueAvatar(c, &media.AvatarJob{
+		Target:     media.AvatarTargetUser,
+		TargetID:   uint(userID),
+		OperatorID: uint(userID),
+	})
+}
+
+// UploadGroupAvatar 上传群组头像，只有群管理员可以修改
+func UploadGroupAvatar(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	groupIDStr := c.Param("id")
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	membership, _, err := checkGroupMember(uint(groupID), uint(userID))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if membership.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该群组的管理员"})
+		return
+	}
+
+	enqueueAvatar(c, &media.AvatarJob{
+		Target:     media.AvatarTargetGroup,
+		TargetID:   uint(groupID),
+		OperatorID: uint(userID),
+	})
+}
+
+// enqueueAvatar 读取表单中的头像图片并加入处理队列
+func enqueueAvatar(c *gin.Context, job *media.AvatarJob) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的图片"})
+		return
+	}
+	if fileHeader.Size > maxAvatarSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "图片过大"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	if err := media.CheckImage(data); err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "不支持的图片"})
+		return
+	}
+
+	job.Data = data
+	if !media.EnqueueAvatar(job) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务繁忙，请稍后重试"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "头像处理中"})
+}
+
+// GetAvatar 获取头像图片。头像地址按内容哈希生成，内容不会变化，可以长期缓存
+func GetAvatar(c *gin.Context) {
+	key, ok := media.AvatarStorageKey(c.Param("file"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "头像不存在"})
+		return
+	}
+
+	reader, err := storage.Store.Get(c.Request.Context(), key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "头像不存在"})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, -1, "image/jpeg", reader, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "public, max-age=31536000, immutable",
+	})
+}
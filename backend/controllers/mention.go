@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// MarkMentionsReadRequest 标记提及已读请求，指定messageIds或groupId之一
+type MarkMentionsReadRequest struct {
+	MessageIDs []uint `json:"messageIds"`
+	GroupID    uint   `json:"groupId"`
+}
+
+// GetUnreadMentions 获取当前用户在所有群组中未读的@提及
+func GetUnreadMentions(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	limit := models.DefaultMessagePageSize
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页大小"})
+			return
+		}
+		limit = l
+	}
+	if limit > models.MaxMessagePageSize {
+		limit = models.MaxMessagePageSize
+	}
+
+	var beforeID uint64
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		beforeID, err = strconv.ParseUint(beforeStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页游标"})
+			return
+		}
+	}
+
+	mentions, err := models.GetUnreadMentions(uint(userID), uint(beforeID), limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取提及失败"})
+		return
+	}
+
+	hasMore := len(mentions) > limit
+	if hasMore {
+		mentions = mentions[:limit]
+	}
+
+	messageIDs := make([]uint, 0, len(mentions))
+	for _, mention := range mentions {
+		messageIDs = append(messageIDs, mention.MessageID)
+	}
+	messages, err := models.GetMessagesByIDs(messageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取提及失败"})
+		return
+	}
+	messageList := make([]*models.Message, 0, len(messages))
+	for _, message := range messages {
+		messageList = append(messageList, message)
+	}
+	if err := decorateMessages(messageList, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取提及失败"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(mentions))
+	for _, mention := range mentions {
+		items = append(items, gin.H{
+			"id":        mention.ID,
+			"messageId": mention.MessageID,
+			"groupId":   mention.GroupID,
+			"senderId":  mention.SenderID,
+			"all":       mention.All,
+			"createdAt": mention.CreatedAt,
+			"message":   messages[mention.MessageID],
+		})
+	}
+
+	var nextBefore uint
+	if hasMore {
+		nextBefore = mentions[len(mentions)-1].ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mentions":   items,
+		"hasMore":    hasMore,
+		"nextBefore": nextBefore,
+	})
+}
+
+// MarkMentionsRead 将@提及标记为已读
+func MarkMentionsRead(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req MarkMentionsReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	var updated int64
+	switch {
+	case req.GroupID != 0:
+		updated, err = models.MarkGroupMentionsRead(uint(userID), req.GroupID)
+	case len(req.MessageIDs) > 0:
+		updated, err = models.MarkMentionsRead(uint(userID), req.MessageIDs)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定消息ID或群组ID"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "标记提及已读失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
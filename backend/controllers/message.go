@@ -1,26 +1,118 @@
 package controllers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
 	"github.com/yourusername/gin-vue-chat/models"
 	"github.com/yourusername/gin-vue-chat/websocket"
 )
 
 // SendPrivateMessageRequest 发送私聊消息请求
 type SendPrivateMessageRequest struct {
-	ReceiverID string `json:"receiverId" binding:"required"`
-	Content    string `json:"content" binding:"required"`
+	ReceiverID    string          `json:"receiverId" binding:"required"`
+	Kind          string          `json:"kind"`          // 可选，内容类型，默认为text
+	Content       string          `json:"content"`       // 文本消息没有附件时必填
+	Payload       json.RawMessage `json:"payload"`       // 非文本消息的结构化数据
+	ReplyToID     string          `json:"replyToId"`     // 可选，引用回复的消息ID
+	AttachmentIDs []uint          `json:"attachmentIds"` // 可选，文本消息附带的附件ID
+}
+
+// EditMessageRequest 编辑消息请求
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required"`
 }
 
 // SendGroupMessageRequest 发送群聊消息请求
 type SendGroupMessageRequest struct {
-	GroupID string `json:"groupId" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	GroupID       string          `json:"groupId" binding:"required"`
+	Kind          string          `json:"kind"`          // 可选，内容类型，默认为text
+	Content       string          `json:"content"`       // 文本消息没有附件时必填
+	Payload       json.RawMessage `json:"payload"`       // 非文本消息的结构化数据
+	ReplyToID     string          `json:"replyToId"`     // 可选，引用回复的消息ID
+	ThreadRootID  string          `json:"threadRootId"`  // 可选，在该消息的话题中回复
+	AttachmentIDs []uint          `json:"attachmentIds"` // 可选，文本消息附带的附件ID
+}
+
+// 游标方向前缀
+const (
+	cursorBefore = "b" // 向更早的消息翻页
+	cursorAfter  = "a" // 向更新的消息翻页
+)
+
+// parseMessagePage 解析消息历史的分页参数。
+// 支持 before/after 消息ID，或上一页返回的不透明游标 cursor
+func parseMessagePage(c *gin.Context) (models.MessagePage, error) {
+	var page models.MessagePage
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			return page, newRequestError(http.StatusBadRequest, "无效的分页大小")
+		}
+		page.Limit = l
+	}
+
+	parseID := func(value string) (uint, error) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || id == 0 {
+			return 0, newRequestError(http.StatusBadRequest, "无效的分页游标")
+		}
+		return uint(id), nil
+	}
+
+	direction, value := "", ""
+	if cursor := c.Query("cursor"); cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return page, newRequestError(http.StatusBadRequest, "无效的分页游标")
+		}
+		parts := strings.SplitN(string(data), ":", 2)
+		if len(parts) != 2 {
+			return page, newRequestError(http.StatusBadRequest, "无效的分页游标")
+		}
+		direction, value = parts[0], parts[1]
+	} else if before := c.Query("before"); before != "" {
+		direction, value = cursorBefore, before
+	} else if after := c.Query("after"); after != "" {
+		direction, value = cursorAfter, after
+	}
+
+	var err error
+	switch direction {
+	case "":
+	case cursorBefore:
+		page.BeforeID, err = parseID(value)
+	case cursorAfter:
+		page.AfterID, err = parseID(value)
+	default:
+		err = newRequestError(http.StatusBadRequest, "无效的分页游标")
+	}
+	return page, err
+}
+
+// nextMessageCursor 生成沿当前分页方向获取下一页的游标，没有更多消息时返回空字符串
+func nextMessageCursor(page models.MessagePage, messages []*models.Message, hasMore bool) string {
+	if !hasMore || len(messages) == 0 {
+		return ""
+	}
+
+	// 消息按ID降序排列
+	var raw string
+	if page.AfterID > 0 {
+		raw = fmt.Sprintf("%s:%d", cursorAfter, messages[0].ID)
+	} else {
+		raw = fmt.Sprintf("%s:%d", cursorBefore, messages[len(messages)-1].ID)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
 }
 
 // GetPrivateMessages 获取私聊消息
@@ -39,59 +131,34 @@ func GetPrivateMessages(c *gin.Context) {
 		return
 	}
 
-	// 检查接收者是否存在
-	_, err = models.GetUserByID(uint(receiverID))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	// 检查接收者是否存在以及是否为好友
+	if err := checkFriend(uint(userID), uint(receiverID)); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 检查是否是好友关系
-	friendships, err := models.GetFriendships(uint(userID), "accepted")
+	// 获取分页参数
+	page, err := parseMessagePage(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		respondError(c, err)
 		return
 	}
 
-	// 验证是否为好友
-	isFriend := false
-	for _, friendship := range friendships {
-		if (friendship.UserID == uint(userID) && friendship.FriendID == uint(receiverID)) ||
-			(friendship.UserID == uint(receiverID) && friendship.FriendID == uint(userID)) {
-			isFriend = true
-			break
-		}
-	}
-
-	// 如果不是好友，返回错误
-	if !isFriend {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该用户的好友"})
-		return
-	}
-
-	// 获取分页参数
-	limit := 20 // 默认每页20条
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	offset := 0 // 默认从第一条开始
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
-	}
-
 	// 获取消息
-	messages, err := models.GetPrivateMessages(uint(userID), uint(receiverID), limit, offset)
+	messages, hasMore, err := models.GetPrivateMessages(uint(userID), uint(receiverID), page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
 		return
 	}
+	if err := decorateMessages(messages, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   messages,
+		"nextCursor": nextMessageCursor(page, messages, hasMore),
+	})
 }
 
 // SendPrivateMessage 发送私聊消息
@@ -110,94 +177,161 @@ func SendPrivateMessage(c *gin.Context) {
 		return
 	}
 
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	message, err := sendPrivateMessage(hub, uint(senderID), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "消息发送成功",
+		"data":    message,
+	})
+}
+
+// sendPrivateMessage 校验并保存私聊消息，然后推送给接收者
+func sendPrivateMessage(hub *websocket.Hub, senderID uint, req *SendPrivateMessageRequest) (*models.Message, error) {
 	// 检查请求参数
 	if req.ReceiverID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "接收者ID不能为空"})
-		return
+		return nil, newRequestError(http.StatusBadRequest, "接收者ID不能为空")
 	}
 
-	if req.Content == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
-		return
+	body, err := resolveMessageBody(senderID, req.Kind, req.Payload, req.Content, req.AttachmentIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	// 转换接收者ID
 	receiverID, err := strconv.ParseUint(req.ReceiverID, 10, 32)
 	if err != nil {
 		log.Printf("接收者ID转换失败: %s, 错误: %v", req.ReceiverID, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的接收者ID"})
-		return
+		return nil, newRequestError(http.StatusBadRequest, "无效的接收者ID")
+	}
+
+	// 检查接收者是否存在以及是否为好友
+	if err := checkFriend(senderID, uint(receiverID)); err != nil {
+		return nil, err
+	}
+
+	// 接收者屏蔽了发送者时，消息照常保存并返回给发送者，但不会出现在接收者的聊天记录中
+	shadow, err := checkBlockedPeer(senderID, uint(receiverID))
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查引用的消息属于同一会话
+	replyToID, err := resolveReplyTo(req.ReplyToID, models.PrivateConversationKey(senderID, uint(receiverID)))
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存消息到MySQL
+	message, err := models.SavePrivateMessage(senderID, uint(receiverID), body.Content, models.SaveMessageOptions{
+		ReplyToID:     replyToID,
+		AttachmentIDs: body.AttachmentIDs,
+		Kind:          body.Kind,
+		Payload:       body.Payload,
+		Shadow:        shadow,
+	})
+	if err == models.ErrAttachmentUnavailable {
+		return nil, newRequestError(http.StatusBadRequest, "附件不存在或已被使用")
+	}
+	if err != nil {
+		log.Printf("保存消息失败: %v", err)
+		return nil, newRequestError(http.StatusInternalServerError, "保存消息失败")
+	}
+	if err := models.LoadReplyPreviews([]*models.Message{message}); err != nil {
+		log.Printf("加载引用消息失败: %v", err)
+	}
+	indexMessage(message)
+
+	// 消息已发出，结束发送者在该会话中的正在输入等状态
+	hub.StopEphemeral(strconv.FormatUint(uint64(senderID), 10), message.ConversationKey, "")
+	if shadow {
+		return message, nil
+	}
+
+	// 记录投递状态，接收者确认收到后更新为已送达
+	if err := models.CreateDeliveries(message.ID, []uint{uint(receiverID)}); err != nil {
+		log.Printf("创建投递记录失败: %v", err)
 	}
 
-	// 检查接收者是否存在
-	_, err = models.GetUserByID(uint(receiverID))
+	// 通过WebSocket发送消息给接收者，离线时等待重新连接后补发
+	sender, _ := models.GetUserByID(senderID)
+	pushMessageEvent(hub, senderID, []uint{uint(receiverID)}, buildPrivateMessageEvent(message, sender))
+
+	return message, nil
+}
+
+// GetGroupMessages 获取群聊消息
+func GetGroupMessages(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "接收者不存在"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
 
-	// 检查是否是好友关系
-	friendships, err := models.GetFriendships(uint(senderID), "accepted")
+	groupIDStr := c.Param("groupId")
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
 		return
 	}
 
-	// 验证是否为好友
-	isFriend := false
-	for _, friendship := range friendships {
-		if (friendship.UserID == uint(senderID) && friendship.FriendID == uint(receiverID)) ||
-			(friendship.UserID == uint(receiverID) && friendship.FriendID == uint(senderID)) {
-			isFriend = true
-			break
-		}
+	// 检查群组是否存在以及用户是否是群组成员
+	if _, _, err := checkGroupMember(uint(groupID), uint(userID)); err != nil {
+		respondError(c, err)
+		return
 	}
 
-	if !isFriend {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该用户的好友"})
+	// 获取分页参数
+	page, err := parseMessagePage(c)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 保存消息到MySQL
-	message, err := models.SavePrivateMessage(uint(senderID), uint(receiverID), req.Content)
+	// 获取消息
+	page.ViewerID = uint(userID)
+	messages, hasMore, err := models.GetGroupMessages(uint(groupID), page)
 	if err != nil {
-		log.Printf("保存消息失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+	if err := decorateMessages(messages, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
 		return
 	}
 
-	// 获取发送者信息
-	sender, _ := models.GetUserByID(uint(senderID))
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   messages,
+		"nextCursor": nextMessageCursor(page, messages, hasMore),
+	})
+}
 
-	// 通过WebSocket发送消息给接收者
-	wsMessage := map[string]interface{}{
-		"type": "private",
-		"message": map[string]interface{}{
-			"id":        message.ID,
-			"from":      senderID,
-			"to":        receiverID,
-			"content":   req.Content,
-			"timestamp": message.Timestamp,
-			"sender": map[string]interface{}{
-				"id":       sender.ID,
-				"username": sender.Username,
-				"avatar":   sender.Avatar,
-			},
-		},
+// SendGroupMessage 发送群聊消息
+func SendGroupMessage(c *gin.Context) {
+	senderIDStr := c.GetString("userId")
+	senderID, err := strconv.ParseUint(senderIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
 	}
 
-	// 获取WebSocket Hub
-	hub := c.MustGet("wsHub").(*websocket.Hub)
+	var req SendGroupMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
 
-	// 发送消息给接收者
-	// 将消息转换为JSON字符串，再转换为字节数组
-	jsonData, err := json.Marshal(gin.H{"data": wsMessage})
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	message, err := sendGroupMessage(hub, uint(senderID), &req)
 	if err != nil {
-		// 记录错误但继续执行，因为这不是致命错误
-		log.Printf("消息序列化失败: %v", err)
+		respondError(c, err)
 		return
 	}
-	hub.SendToUser(strconv.FormatUint(uint64(receiverID), 10), jsonData)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "消息发送成功",
@@ -205,196 +339,706 @@ func SendPrivateMessage(c *gin.Context) {
 	})
 }
 
-// GetGroupMessages 获取群聊消息
-func GetGroupMessages(c *gin.Context) {
-	userIDStr := c.GetString("userId")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+// sendGroupMessage 校验并保存群聊消息，然后推送给其他群组成员
+func sendGroupMessage(hub *websocket.Hub, senderID uint, req *SendGroupMessageRequest) (*models.Message, error) {
+	// 转换群组ID
+	groupID, err := strconv.ParseUint(req.GroupID, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
-		return
+		return nil, newRequestError(http.StatusBadRequest, "无效的群组ID")
 	}
 
-	groupIDStr := c.Param("groupId")
-	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	// 检查群组是否存在以及用户是否是群组成员
+	membership, members, err := checkGroupMember(uint(groupID), senderID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
-		return
+		return nil, err
 	}
 
-	// 检查群组是否存在
-	_, err = models.GetGroupByID(uint(groupID))
+	body, err := resolveMessageBody(senderID, req.Kind, req.Payload, req.Content, req.AttachmentIDs)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "群组不存在"})
-		return
+		return nil, err
 	}
 
-	// 检查用户是否是群组成员
-	members, err := models.GetGroupMembers(uint(groupID))
+	// 检查引用的消息属于同一会话
+	replyToID, err := resolveReplyTo(req.ReplyToID, models.GroupConversationKey(uint(groupID)))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
-		return
+		return nil, err
+	}
+
+	// 检查话题根消息
+	threadRoot, err := resolveThreadRoot(req.ThreadRootID, uint(groupID))
+	if err != nil {
+		return nil, err
+	}
+	var threadRootID uint
+	if threadRoot != nil {
+		threadRootID = threadRoot.ID
+	}
+
+	// 解析@提及
+	mentionUserIDs, mentionAll, err := resolveMentions(body.Content, membership, members)
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "获取群组成员失败")
+	}
+
+	// 保存消息到MySQL
+	message, err := models.SaveGroupMessage(senderID, uint(groupID), body.Content, models.SaveMessageOptions{
+		ReplyToID:      replyToID,
+		ThreadRootID:   threadRootID,
+		MentionUserIDs: mentionUserIDs,
+		MentionAll:     mentionAll,
+		AttachmentIDs:  body.AttachmentIDs,
+		Kind:           body.Kind,
+		Payload:        body.Payload,
+	})
+	if err == models.ErrAttachmentUnavailable {
+		return nil, newRequestError(http.StatusBadRequest, "附件不存在或已被使用")
+	}
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "保存消息失败")
+	}
+	if err := models.LoadReplyPreviews([]*models.Message{message}); err != nil {
+		log.Printf("加载引用消息失败: %v", err)
+	}
+	indexMessage(message)
+
+	// 消息已发出，结束发送者在该会话中的正在输入等状态
+	hub.StopEphemeral(strconv.FormatUint(uint64(senderID), 10), message.ConversationKey, "")
+
+	sender, _ := models.GetUserByID(senderID)
+	if len(message.Mentions) > 0 || message.MentionAll {
+		notifyMentions(hub, message, sender)
+	}
+	if threadRoot != nil {
+		notifyThreadReply(hub, threadRoot, message, sender, members)
+		return message, nil
 	}
 
-	// 验证用户是否在群组中
-	isMember := false
+	// 记录每个成员的投递状态
+	receiverIDs := make([]uint, 0, len(members))
 	for _, member := range members {
-		if member.UserID == uint(userID) {
-			isMember = true
-			break
+		if member.UserID != senderID { // 不需要发送给自己
+			receiverIDs = append(receiverIDs, member.UserID)
 		}
 	}
+	if err := models.CreateDeliveries(message.ID, receiverIDs); err != nil {
+		log.Printf("创建投递记录失败: %v", err)
+	}
 
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该群组的成员"})
-		return
+	// 通过WebSocket发送消息给群组其他成员
+	pushMessageEvent(hub, senderID, receiverIDs, buildGroupMessageEvent(message, sender))
+
+	return message, nil
+}
+
+// maxMessageAttachments 单条消息最多携带的附件数
+const maxMessageAttachments = 9
+
+// checkMessageContent 检查消息内容和附件，至少需要其中一项，返回去重后的附件ID
+func checkMessageContent(content string, attachmentIDs []uint) ([]uint, error) {
+	seen := make(map[uint]bool, len(attachmentIDs))
+	ids := make([]uint, 0, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
 	}
 
-	// 获取分页参数
-	limit := 20 // 默认每页20条
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
+	if content == "" && len(ids) == 0 {
+		return nil, newRequestError(http.StatusBadRequest, "消息内容不能为空")
+	}
+	if len(ids) > maxMessageAttachments {
+		return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("单条消息最多包含%d个附件", maxMessageAttachments))
+	}
+	return ids, nil
+}
+
+// resolveMentions 解析消息中@到的群成员，只有群管理员可以@所有人，其他成员的@all按普通文本处理
+func resolveMentions(content string, membership *models.GroupMember, members []*models.GroupMember) ([]uint, bool, error) {
+	if !strings.Contains(content, "@") {
+		return nil, false, nil
+	}
+
+	memberIDs := make([]uint, 0, len(members))
+	for _, member := range members {
+		if member.UserID != membership.UserID {
+			memberIDs = append(memberIDs, member.UserID)
 		}
 	}
+	users, err := models.GetUsersByIDs(memberIDs)
+	if err != nil {
+		return nil, false, err
+	}
 
-	offset := 0 // 默认从第一条开始
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
+	usernames := make(map[string]uint, len(users))
+	for _, user := range users {
+		usernames[user.Username] = user.ID
+	}
+
+	userIDs, all := models.ParseMentions(content, usernames)
+	if membership.Role != "admin" {
+		all = false
+	}
+	return userIDs, all, nil
+}
+
+// notifyMentions 向被@的用户推送提及通知
+func notifyMentions(hub *websocket.Hub, message *models.Message, sender *models.User) {
+	userIDs, err := models.GetMentionedUserIDs(message.ID)
+	if err != nil {
+		log.Printf("获取提及记录失败: %v", err)
+		return
+	}
+
+	explicit := make(map[uint]bool, len(message.Mentions))
+	for _, userID := range message.Mentions {
+		explicit[userID] = true
+	}
+
+	aliases, err := models.GetAliasesForFriend(message.SenderID, userIDs)
+	if err != nil {
+		log.Printf("获取好友备注失败: %v", err)
+	}
+	messageEvent := buildGroupMessageEvent(message, sender)["message"]
+	for _, userID := range userIDs {
+		event := map[string]interface{}{
+			"type":      "mention",
+			"messageId": message.ID,
+			"groupId":   message.GroupID,
+			"senderId":  message.SenderID,
+			"all":       !explicit[userID],
+			"message":   messageEvent,
 		}
+		if alias, ok := aliases[userID]; ok {
+			event = withSenderAlias(event, alias)
+		}
+		pushToUser(hub, userID, event)
 	}
+}
 
-	// 获取消息
-	messages, err := models.GetGroupMessages(uint(groupID), limit, offset)
+// resolveThreadRoot 解析并校验话题根消息，根消息必须是同一群组主时间线中未撤回的消息
+func resolveThreadRoot(threadRootIDStr string, groupID uint) (*models.Message, error) {
+	if threadRootIDStr == "" {
+		return nil, nil
+	}
+
+	threadRootID, err := strconv.ParseUint(threadRootIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return nil, newRequestError(http.StatusBadRequest, "无效的话题ID")
+	}
+
+	root, err := models.GetMessageByID(uint(threadRootID))
+	if err != nil || root.Type != models.MessageTypeGroup || root.GroupID != groupID {
+		return nil, newRequestError(http.StatusBadRequest, "话题不存在")
+	}
+	if root.ThreadRootID != nil {
+		return nil, newRequestError(http.StatusBadRequest, "不能在话题回复中再开启话题")
+	}
+	if root.Recalled {
+		return nil, newRequestError(http.StatusBadRequest, "话题消息已撤回")
+	}
+	return root, nil
+}
+
+// notifyThreadReply 推送话题回复：话题参与者收到完整的回复，其他群成员只收到话题的回复数更新
+func notifyThreadReply(hub *websocket.Hub, root, reply *models.Message, sender *models.User, members []*models.GroupMember) {
+	participants, err := models.GetThreadParticipantIDs(root)
+	if err != nil {
+		log.Printf("获取话题参与者失败: %v", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+	// 回复保存后重新读取根消息以获取最新的回复数
+	if updated, err := models.GetMessageByID(root.ID); err == nil {
+		root = updated
+	}
+
+	isParticipant := make(map[uint]bool, len(participants))
+	receiverIDs := make([]uint, 0, len(participants))
+	for _, participantID := range participants {
+		isParticipant[participantID] = true
+		if participantID != reply.SenderID {
+			receiverIDs = append(receiverIDs, participantID)
+		}
+	}
+
+	// 只为话题参与者记录投递状态
+	if err := models.CreateDeliveries(reply.ID, receiverIDs); err != nil {
+		log.Printf("创建投递记录失败: %v", err)
+	}
+
+	threadSummary := map[string]interface{}{
+		"rootId":      root.ID,
+		"groupId":     root.GroupID,
+		"replyCount":  root.ThreadReplyCount,
+		"lastReplyAt": root.ThreadLastReplyAt,
+	}
+
+	replyEvent := buildGroupMessageEvent(reply, sender)
+	replyEvent["type"] = "thread_reply"
+	replyEvent["thread"] = threadSummary
+	pushMessageEvent(hub, reply.SenderID, receiverIDs, replyEvent)
+
+	updateEvent := map[string]interface{}{
+		"type":   "thread_update",
+		"thread": threadSummary,
+	}
+	for _, member := range members {
+		if !isParticipant[member.UserID] || member.UserID == reply.SenderID {
+			pushToUser(hub, member.UserID, updateEvent)
+		}
+	}
 }
 
-// SendGroupMessage 发送群聊消息
-func SendGroupMessage(c *gin.Context) {
-	senderIDStr := c.GetString("userId")
-	senderID, err := strconv.ParseUint(senderIDStr, 10, 32)
+// GetThreadMessages 获取话题中的回复
+func GetThreadMessages(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
 
-	var req SendGroupMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+	rootIDStr := c.Param("rootId")
+	rootID, err := strconv.ParseUint(rootIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的话题ID"})
 		return
 	}
 
-	// 转换群组ID
-	groupID, err := strconv.ParseUint(req.GroupID, 10, 32)
+	root, err := models.GetMessageByID(uint(rootID))
+	if err != nil || root.Type != models.MessageTypeGroup || root.ThreadRootID != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "话题不存在"})
+		return
+	}
+
+	// 检查用户是否是群组成员
+	if _, _, err := checkGroupMember(root.GroupID, uint(userID)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	page, err := parseMessagePage(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		respondError(c, err)
 		return
 	}
 
-	// 检查群组是否存在
-	_, err = models.GetGroupByID(uint(groupID))
+	page.ViewerID = uint(userID)
+	messages, hasMore, err := models.GetThreadMessages(root.ID, page)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "群组不存在"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取话题回复失败"})
+		return
+	}
+	if err := decorateMessages(append(messages, root), uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取话题回复失败"})
 		return
 	}
 
-	// 检查用户是否是群组成员
-	members, err := models.GetGroupMembers(uint(groupID))
+	c.JSON(http.StatusOK, gin.H{
+		"root":       root,
+		"messages":   messages,
+		"nextCursor": nextMessageCursor(page, messages, hasMore),
+	})
+}
+
+// EditMessage 编辑自己发送的消息
+func EditMessage(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
 
-	// 验证用户是否在群组中
-	isMember := false
-	for _, member := range members {
-		if member.UserID == uint(senderID) {
-			isMember = true
-			break
-		}
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
 	}
 
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该群组的成员"})
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
 		return
 	}
 
-	// 保存消息到MySQL
-	message, err := models.SaveGroupMessage(uint(senderID), uint(groupID), req.Content)
+	message, err := models.GetMessageByID(uint(messageID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
 		return
 	}
 
-	// 获取发送者信息
-	sender, _ := models.GetUserByID(uint(senderID))
+	// 只有发送者可以编辑，且必须在允许的时间内
+	if message.SenderID != uint(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能编辑自己发送的消息"})
+		return
+	}
 
-	// 通过WebSocket发送消息给群组所有成员
-	wsMessage := map[string]interface{}{
-		"type": "group",
-		"message": map[string]interface{}{
-			"id":        message.ID,
-			"groupId":   groupID,
-			"senderId":  senderID,
-			"content":   req.Content,
-			"timestamp": message.Timestamp,
-			"sender": map[string]interface{}{
-				"id":       sender.ID,
-				"username": sender.Username,
-				"avatar":   sender.Avatar,
-			},
-		},
+	if message.Recalled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息已撤回"})
+		return
 	}
 
-	// 获取WebSocket Hub
-	hub := c.MustGet("wsHub").(*websocket.Hub)
+	// 非文本消息的content是根据payload生成的摘要，不能直接修改
+	if message.Kind != models.MessageKindText {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能编辑文本消息"})
+		return
+	}
 
-	// 发送消息给所有成员
-	for _, member := range members {
-		if member.UserID != uint(senderID) { // 不需要发送给自己
-			jsonData, err := json.Marshal(gin.H{"data": wsMessage})
-			if err != nil {
-				log.Printf("消息序列化失败: %v", err)
-				continue
-			}
-			hub.SendToUser(strconv.FormatUint(uint64(member.UserID), 10), jsonData)
+	if time.Since(message.Timestamp) > config.AppConfig.Message.EditWindow {
+		c.JSON(http.StatusForbidden, gin.H{"error": "消息已超过可编辑时间"})
+		return
+	}
+
+	// 发送者仍需是会话成员
+	participants, err := getConversationParticipants(message, uint(userID))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if req.Content != message.Content {
+		if err := models.EditMessage(message, req.Content); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "编辑消息失败"})
+			return
+		}
+		indexMessage(message)
+		if err := models.LoadReplyPreviews([]*models.Message{message}); err != nil {
+			log.Printf("加载引用消息失败: %v", err)
 		}
+		if err := models.LoadMentions([]*models.Message{message}); err != nil {
+			log.Printf("加载提及记录失败: %v", err)
+		}
+		if err := models.LoadAttachments([]*models.Message{message}); err != nil {
+			log.Printf("加载附件失败: %v", err)
+		}
+
+		// 通知会话中的所有成员，包括发送者的其他设备
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		sender, _ := models.GetUserByID(message.SenderID)
+		event := buildMessageEvent(message, sender)
+		event["type"] = "edit"
+		pushMessageEvent(hub, message.SenderID, withoutShadowedReceiver(message, participants), event)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "消息发送成功",
+		"message": "消息已编辑",
 		"data":    message,
 	})
 }
 
-// MarkMessagesAsRead 标记消息为已读
-func MarkMessagesAsRead(c *gin.Context) {
-	// 获取消息ID列表
-	var req struct {
-		MessageIDs []uint `json:"messageIds" binding:"required"`
+// GetMessageRevisions 获取消息的编辑历史
+func GetMessageRevisions(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	message, err := models.GetMessageByID(uint(messageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	if _, err := getConversationParticipants(message, uint(userID)); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkMessageVisible(message, uint(userID)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	revisions, err := models.GetMessageRevisions(message.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取编辑历史失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// RecallMessage 撤回消息（对所有人删除）
+// 发送者可以在允许的时间内撤回，群管理员可以随时撤回群内任何消息
+func RecallMessage(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	message, err := models.GetMessageByID(uint(messageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	if message.Recalled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息已撤回"})
+		return
+	}
+
+	// 检查操作者是会话成员，并判断是否为群管理员
+	isAdmin := false
+	var participants []uint
+	if message.Type == models.MessageTypeGroup {
+		membership, members, err := checkGroupMember(message.GroupID, uint(userID))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		isAdmin = membership.Role == "admin"
+		for _, member := range members {
+			participants = append(participants, member.UserID)
+		}
+	} else {
+		participants, err = getConversationParticipants(message, uint(userID))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	if !isAdmin {
+		if message.SenderID != uint(userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能撤回自己发送的消息"})
+			return
+		}
+		if time.Since(message.Timestamp) > config.AppConfig.Message.RecallWindow {
+			c.JSON(http.StatusForbidden, gin.H{"error": "消息已超过可撤回时间"})
+			return
+		}
+	}
+
+	if err := models.RecallMessage(message, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤回消息失败"})
 		return
 	}
+	indexMessage(message)
 
-	if len(req.MessageIDs) == 0 {
+	// 通知会话中的所有成员
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	event := map[string]interface{}{
+		"type":             "recall",
+		"messageId":        message.ID,
+		"conversationType": message.Type,
+		"conversationKey":  message.ConversationKey,
+		"groupId":          message.GroupID,
+		"senderId":         message.SenderID,
+		"recalledBy":       message.RecalledBy,
+		"recalledAt":       message.RecalledAt,
+	}
+	for _, participantID := range withoutShadowedReceiver(message, participants) {
+		pushToUser(hub, participantID, event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "消息已撤回"})
+}
+
+// DeleteMessageForMe 仅在自己的聊天记录中删除消息
+func DeleteMessageForMe(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
 		return
 	}
 
-	// 标记消息为已读
-	err := models.MarkMessagesAsRead(req.MessageIDs)
+	message, err := models.GetMessageByID(uint(messageID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "标记消息失败"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	// 只要曾经能看到这条消息就可以删除，不要求仍是好友或群成员
+	if message.Type == models.MessageTypePrivate &&
+		message.SenderID != uint(userID) && message.ReceiverID != uint(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该会话的成员"})
+		return
+	}
+	if message.Type == models.MessageTypeGroup {
+		if _, _, err := checkGroupMember(message.GroupID, uint(userID)); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	if err := models.HideMessage(message, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除消息失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "消息已标记为已读"})
-}
\ No newline at end of file
+	// 同步到自己的其他设备
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	pushToUser(hub, uint(userID), map[string]interface{}{
+		"type":             "delete",
+		"messageId":        message.ID,
+		"conversationType": message.Type,
+		"conversationKey":  message.ConversationKey,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "消息已删除"})
+}
+
+// resolveReplyTo 解析并校验引用回复的消息ID，被引用的消息必须属于同一会话且未被撤回
+func resolveReplyTo(replyToIDStr, conversationKey string) (uint, error) {
+	if replyToIDStr == "" {
+		return 0, nil
+	}
+
+	replyToID, err := strconv.ParseUint(replyToIDStr, 10, 32)
+	if err != nil {
+		return 0, newRequestError(http.StatusBadRequest, "无效的引用消息ID")
+	}
+
+	original, err := models.GetMessageByID(uint(replyToID))
+	if err != nil || original.ConversationKey != conversationKey {
+		return 0, newRequestError(http.StatusBadRequest, "引用的消息不存在")
+	}
+	if original.Recalled {
+		return 0, newRequestError(http.StatusBadRequest, "引用的消息已撤回")
+	}
+	return original.ID, nil
+}
+
+// getConversationParticipants 检查用户有权访问消息所在的会话，并返回会话的全部成员ID
+func getConversationParticipants(message *models.Message, userID uint) ([]uint, error) {
+	if message.Type == models.MessageTypeGroup {
+		_, members, err := checkGroupMember(message.GroupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		participants := make([]uint, 0, len(members))
+		for _, member := range members {
+			participants = append(participants, member.UserID)
+		}
+		return participants, nil
+	}
+
+	if userID != message.SenderID && userID != message.ReceiverID {
+		return nil, newRequestError(http.StatusForbidden, "您不是该会话的成员")
+	}
+
+	peerID := message.ReceiverID
+	if userID == message.ReceiverID {
+		peerID = message.SenderID
+	}
+	if err := checkFriend(userID, peerID); err != nil {
+		return nil, err
+	}
+	return []uint{message.SenderID, message.ReceiverID}, nil
+}
+
+// checkMessageVisible 检查消息没有对用户隐藏（被屏蔽时静默保存或仅对自己删除），
+// 隐藏的消息对该用户按不存在处理
+func checkMessageVisible(message *models.Message, userID uint) error {
+	hidden, err := models.GetHiddenMessageIDs(userID, []uint{message.ID})
+	if err != nil {
+		return newRequestError(http.StatusInternalServerError, "获取消息失败")
+	}
+	if hidden[message.ID] {
+		return newRequestError(http.StatusNotFound, "消息不存在")
+	}
+	return nil
+}
+
+// buildSenderInfo 构建消息推送中的发送者信息
+func buildSenderInfo(sender *models.User) map[string]interface{} {
+	if sender == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":          sender.ID,
+		"username":    sender.Username,
+		"nickname":    sender.Nickname,
+		"displayName": displayName(sender, ""),
+		"avatar":      sender.Avatar,
+	}
+}
+
+// buildPrivateMessageEvent 构建推送给接收者的私聊消息事件
+func buildPrivateMessageEvent(message *models.Message, sender *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "private",
+		"message": map[string]interface{}{
+			"id":          message.ID,
+			"from":        message.SenderID,
+			"to":          message.ReceiverID,
+			"kind":        message.Kind,
+			"content":     message.Content,
+			"payload":     message.Payload,
+			"timestamp":   message.Timestamp,
+			"seq":         message.Seq,
+			"edited":      message.Edited,
+			"editedAt":    message.EditedAt,
+			"recalled":    message.Recalled,
+			"replyToId":   message.ReplyToID,
+			"replyTo":     message.ReplyTo,
+			"attachments": message.Attachments,
+			"sender":      buildSenderInfo(sender),
+		},
+	}
+}
+
+// buildGroupMessageEvent 构建推送给群组成员的群聊消息事件
+func buildGroupMessageEvent(message *models.Message, sender *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "group",
+		"message": map[string]interface{}{
+			"id":                message.ID,
+			"groupId":           message.GroupID,
+			"senderId":          message.SenderID,
+			"kind":              message.Kind,
+			"content":           message.Content,
+			"payload":           message.Payload,
+			"timestamp":         message.Timestamp,
+			"seq":               message.Seq,
+			"edited":            message.Edited,
+			"editedAt":          message.EditedAt,
+			"recalled":          message.Recalled,
+			"replyToId":         message.ReplyToID,
+			"replyTo":           message.ReplyTo,
+			"threadRootId":      message.ThreadRootID,
+			"threadReplyCount":  message.ThreadReplyCount,
+			"threadLastReplyAt": message.ThreadLastReplyAt,
+			"mentions":          message.Mentions,
+			"mentionAll":        message.MentionAll,
+			"attachments":       message.Attachments,
+			"sender":            buildSenderInfo(sender),
+		},
+	}
+}
+
+// buildMessageEvent 根据消息类型构建推送事件
+func buildMessageEvent(message *models.Message, sender *models.User) map[string]interface{} {
+	if message.Type == models.MessageTypeGroup {
+		return buildGroupMessageEvent(message, sender)
+	}
+	return buildPrivateMessageEvent(message, sender)
+}
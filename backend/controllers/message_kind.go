@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// 结构化消息的字段限制
+const (
+	maxCaptionLength         = 1000 // 图片说明的最大字符数
+	maxVoiceDuration         = 300  // 语音的最长秒数
+	maxLocationNameLength    = 100
+	maxLocationAddressLength = 200
+)
+
+// messageBody 校验后的消息内容
+type messageBody struct {
+	Kind          string
+	Payload       json.RawMessage
+	Content       string
+	AttachmentIDs []uint
+}
+
+// resolveMessageBody 按内容类型校验payload，返回保存用的消息内容。
+// 非文本消息的content由服务端根据payload生成摘要，附件通过payload中的attachmentId指定
+func resolveMessageBody(senderID uint, kind string, payload json.RawMessage, content string, attachmentIDs []uint) (*messageBody, error) {
+	if kind == "" || kind == models.MessageKindText {
+		if len(payload) > 0 && string(payload) != "null" {
+			return nil, newRequestError(http.StatusBadRequest, "文本消息不能包含payload")
+		}
+		ids, err := checkMessageContent(content, attachmentIDs)
+		if err != nil {
+			return nil, err
+		}
+		return &messageBody{Kind: models.MessageKindText, Content: content, AttachmentIDs: ids}, nil
+	}
+
+	if kind == models.MessageKindSystem {
+		return nil, newRequestError(http.StatusBadRequest, "不能发送系统消息")
+	}
+	if content != "" || len(attachmentIDs) > 0 {
+		return nil, newRequestError(http.StatusBadRequest, "该类型的消息内容只能放在payload中")
+	}
+	if len(payload) == 0 {
+		return nil, newRequestError(http.StatusBadRequest, "缺少消息payload")
+	}
+
+	var (
+		value        interface{}
+		attachmentID uint
+		err          error
+	)
+	switch kind {
+	case models.MessageKindImage:
+		var p models.ImagePayload
+		if err := decodeKindPayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if utf8.RuneCountInString(p.Caption) > maxCaptionLength {
+			return nil, newRequestError(http.StatusBadRequest, "图片说明过长")
+		}
+		_, err = loadUnsentAttachment(senderID, p.AttachmentID, models.AttachmentKindImage)
+		value, attachmentID = &p, p.AttachmentID
+
+	case models.MessageKindFile:
+		var p models.FilePayload
+		if err := decodeKindPayload(payload, &p); err != nil {
+			return nil, err
+		}
+		var attachment *models.Attachment
+		attachment, err = loadUnsentAttachment(senderID, p.AttachmentID, "")
+		if attachment != nil {
+			p.FileName = attachment.FileName
+			p.Size = attachment.Size
+		}
+		value, attachmentID = &p, p.AttachmentID
+
+	case models.MessageKindVoice:
+		var p models.VoicePayload
+		if err := decodeKindPayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.Duration <= 0 || p.Duration > maxVoiceDuration {
+			return nil, newRequestError(http.StatusBadRequest, "无效的语音时长")
+		}
+		_, err = loadUnsentAttachment(senderID, p.AttachmentID, models.AttachmentKindAudio)
+		value, attachmentID = &p, p.AttachmentID
+
+	case models.MessageKindLocation:
+		var p models.LocationPayload
+		if err := decodeKindPayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+			return nil, newRequestError(http.StatusBadRequest, "无效的经纬度")
+		}
+		if utf8.RuneCountInString(p.Name) > maxLocationNameLength || utf8.RuneCountInString(p.Address) > maxLocationAddressLength {
+			return nil, newRequestError(http.StatusBadRequest, "地点名称或地址过长")
+		}
+		value = &p
+
+	case models.MessageKindCard:
+		var p models.CardPayload
+		if err := decodeKindPayload(payload, &p); err != nil {
+			return nil, err
+		}
+		err = fillCardPayload(senderID, &p)
+		value = &p
+
+	default:
+		return nil, newRequestError(http.StatusBadRequest, "不支持的消息类型")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := models.EncodeMessagePayload(value)
+	if err != nil {
+		return nil, err
+	}
+	body := &messageBody{
+		Kind:    kind,
+		Payload: encoded,
+		Content: models.MessageKindSummary(value),
+	}
+	if attachmentID != 0 {
+		body.AttachmentIDs = []uint{attachmentID}
+	}
+	return body, nil
+}
+
+// decodeKindPayload 解析payload，格式错误时返回请求错误
+func decodeKindPayload(payload json.RawMessage, v interface{}) error {
+	if err := models.DecodeMessagePayload(payload, v); err != nil {
+		return newRequestError(http.StatusBadRequest, "消息payload格式无效")
+	}
+	return nil
+}
+
+// loadUnsentAttachment 获取发送者上传且尚未发送的附件，kind不为空时检查附件类型
+func loadUnsentAttachment(senderID, attachmentID uint, kind string) (*models.Attachment, error) {
+	if attachmentID == 0 {
+		return nil, newRequestError(http.StatusBadRequest, "缺少附件ID")
+	}
+	attachment, err := models.GetAttachmentByID(attachmentID)
+	if err != nil || attachment.UploaderID != senderID || attachment.MessageID != nil {
+		return nil, newRequestError(http.StatusBadRequest, "附件不存在或已被使用")
+	}
+	if kind != "" && attachment.Kind != kind {
+		return nil, newRequestError(http.StatusBadRequest, "附件类型与消息类型不匹配")
+	}
+	return attachment, nil
+}
+
+// fillCardPayload 检查名片指向的用户或群组，并填充名称和头像的快照。群名片只能由群成员发送，
+// 个人名片与查看资料相同，只能分享隐私设置允许发送者找到、且没有屏蔽发送者的用户
+func fillCardPayload(senderID uint, p *models.CardPayload) error {
+	switch p.CardType {
+	case models.CardTypeUser:
+		user, err := models.GetUserByID(p.ID)
+		if err != nil {
+			return newRequestError(http.StatusNotFound, "用户不存在")
+		}
+		blocked, err := models.IsBlocked(user.ID, senderID)
+		if err != nil {
+			return newRequestError(http.StatusInternalServerError, "服务器错误")
+		}
+		if blocked {
+			return newRequestError(http.StatusNotFound, "用户不存在")
+		}
+		if err := checkUserVisible(senderID, user); err != nil {
+			return err
+		}
+		p.Name = user.Username
+		p.Avatar = user.Avatar
+	case models.CardTypeGroup:
+		if _, _, err := checkGroupMember(p.ID, senderID); err != nil {
+			return err
+		}
+		group, err := models.GetGroupByID(p.ID)
+		if err != nil {
+			return newRequestError(http.StatusNotFound, "群组不存在")
+		}
+		p.Name = group.Name
+		p.Avatar = group.Avatar
+	default:
+		return newRequestError(http.StatusBadRequest, "无效的名片类型")
+	}
+	return nil
+}
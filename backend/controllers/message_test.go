@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// testPageContext 构造带有查询参数的请求上下文
+func testPageContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/messages?"+query, nil)
+	return c
+}
+
+func TestParseMessagePage(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    models.MessagePage
+		wantErr bool
+	}{
+		{"default", "", models.MessagePage{}, false},
+		{"limit", "limit=30", models.MessagePage{Limit: 30}, false},
+		{"before", "before=42", models.MessagePage{BeforeID: 42}, false},
+		{"after", "after=42", models.MessagePage{AfterID: 42}, false},
+		{"before cursor", "cursor=" + encode("b:42"), models.MessagePage{BeforeID: 42}, false},
+		{"after cursor", "cursor=" + encode("a:7") + "&limit=5", models.MessagePage{AfterID: 7, Limit: 5}, false},
+		{"cursor wins over before", "cursor=" + encode("a:7") + "&before=42", models.MessagePage{AfterID: 7}, false},
+		{"invalid limit", "limit=0", models.MessagePage{}, true},
+		{"invalid base64", "cursor=!!!", models.MessagePage{}, true},
+		{"missing direction", "cursor=" + encode("42"), models.MessagePage{}, true},
+		{"unknown direction", "cursor=" + encode("x:42"), models.MessagePage{}, true},
+		{"zero id", "cursor=" + encode("b:0"), models.MessagePage{}, true},
+		{"non numeric id", "before=abc", models.MessagePage{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := parseMessagePage(testPageContext(tt.query))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("page = %+v, want error", page)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page != tt.want {
+				t.Errorf("page = %+v, want %+v", page, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextMessageCursor(t *testing.T) {
+	// 消息按ID降序排列
+	messages := []*models.Message{{ID: 30}, {ID: 20}, {ID: 10}}
+
+	tests := []struct {
+		name     string
+		page     models.MessagePage
+		messages []*models.Message
+		hasMore  bool
+		want     models.MessagePage
+	}{
+		{"older page continues before oldest", models.MessagePage{}, messages, true, models.MessagePage{BeforeID: 10}},
+		{"before page continues before oldest", models.MessagePage{BeforeID: 40}, messages, true, models.MessagePage{BeforeID: 10}},
+		{"after page continues after newest", models.MessagePage{AfterID: 5}, messages, true, models.MessagePage{AfterID: 30}},
+		{"no more messages", models.MessagePage{}, messages, false, models.MessagePage{}},
+		{"empty page", models.MessagePage{}, nil, true, models.MessagePage{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := nextMessageCursor(tt.page, tt.messages, tt.hasMore)
+			if tt.want == (models.MessagePage{}) {
+				if cursor != "" {
+					t.Fatalf("cursor = %q, want empty", cursor)
+				}
+				return
+			}
+
+			// 生成的游标可以被parseMessagePage解析回相同的位置
+			page, err := parseMessagePage(testPageContext("cursor=" + cursor))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page != tt.want {
+				t.Errorf("page = %+v, want %+v", page, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// presenceChangeHandler 保存用户的在线状态，并推送给好友和同群成员
+func presenceChangeHandler(hub *websocket.Hub) func(websocket.PresenceChange) {
+	return func(change websocket.PresenceChange) {
+		userID, err := strconv.ParseUint(change.UserID, 10, 32)
+		if err != nil {
+			return
+		}
+
+		if err := models.UpdatePresence(uint(userID), change.Status, change.LastSeenAt); err != nil {
+			log.Printf("更新在线状态失败: %v", err)
+		}
+
+		recipients, err := models.GetRelatedUserIDs(uint(userID))
+		if err != nil {
+			log.Printf("获取在线状态订阅者失败: %v", err)
+			return
+		}
+
+		event := map[string]interface{}{
+			"type":       "presence",
+			"userId":     uint(userID),
+			"status":     change.Status,
+			"lastSeenAt": change.LastSeenAt,
+		}
+		for _, recipientID := range recipients {
+			// 互相屏蔽的用户之间不推送在线状态
+			if hub.IsBlockedBetween(change.UserID, strconv.FormatUint(uint64(recipientID), 10)) {
+				continue
+			}
+			pushToUser(hub, recipientID, event)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// maxEmojiLength 表情的最大字符数，组合表情由多个码点组成
+const maxEmojiLength = 16
+
+// AddReactionRequest 添加表情回应请求
+type AddReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// validateEmoji 检查表情是否有效
+func validateEmoji(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+	return strings.TrimSpace(emoji) == emoji && !strings.ContainsAny(emoji, " \t\r\n")
+}
+
+// AddReaction 对消息添加表情回应
+func AddReaction(c *gin.Context) {
+	var req AddReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	updateReaction(c, req.Emoji, true)
+}
+
+// RemoveReaction 取消对消息的表情回应
+func RemoveReaction(c *gin.Context) {
+	updateReaction(c, c.Param("emoji"), false)
+}
+
+// updateReaction 添加或取消表情回应，并通知会话中的所有成员
+func updateReaction(c *gin.Context, emoji string, add bool) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	if !validateEmoji(emoji) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的表情"})
+		return
+	}
+
+	message, err := models.GetMessageByID(uint(messageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	// 与查看聊天记录相同的成员检查
+	participants, err := getConversationParticipants(message, uint(userID))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkMessageVisible(message, uint(userID)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if message.Recalled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息已撤回"})
+		return
+	}
+
+	var changed bool
+	if add {
+		changed, err = models.AddReaction(message, uint(userID), emoji)
+	} else {
+		changed, err = models.RemoveReaction(message, uint(userID), emoji)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新表情回应失败"})
+		return
+	}
+
+	summaries, err := models.GetReactionSummaries([]uint{message.ID}, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取表情回应失败"})
+		return
+	}
+	reactions := summaries[message.ID]
+	if reactions == nil {
+		reactions = []models.ReactionSummary{}
+	}
+
+	if changed {
+		action := "add"
+		if !add {
+			action = "remove"
+		}
+
+		// 推送给所有人的汇总不包含"我是否回应过"，由客户端根据userId和action自行更新
+		counts := make([]models.ReactionSummary, len(reactions))
+		for i, reaction := range reactions {
+			counts[i] = models.ReactionSummary{Emoji: reaction.Emoji, Count: reaction.Count}
+		}
+
+		hub := c.MustGet("wsHub").(*websocket.Hub)
+		event := map[string]interface{}{
+			"type":             "reaction",
+			"action":           action,
+			"messageId":        message.ID,
+			"conversationType": message.Type,
+			"conversationKey":  message.ConversationKey,
+			"groupId":          message.GroupID,
+			"userId":           userID,
+			"emoji":            emoji,
+			"reactions":        counts,
+		}
+		for _, participantID := range withoutShadowedReceiver(message, participants) {
+			pushToUser(hub, participantID, event)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messageId": message.ID, "reactions": reactions})
+}
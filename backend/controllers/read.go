@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// MarkReadRequest 标记会话已读请求，将会话中不晚于MessageID的消息全部标记为已读
+type MarkReadRequest struct {
+	ConversationType string `json:"conversationType" binding:"required"` // private, group
+	TargetID         string `json:"targetId" binding:"required"`         // 私聊为对方用户ID，群聊为群组ID
+	MessageID        uint   `json:"messageId" binding:"required"`
+}
+
+// MarkMessagesAsRead 推进当前用户在会话中的已读位置
+func MarkMessagesAsRead(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	result, err := markConversationRead(hub, uint(userID), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// markConversationRead 检查会话成员身份后推进已读位置，并向相关消息的发送者推送已读回执
+func markConversationRead(hub *websocket.Hub, userID uint, req *MarkReadRequest) (map[string]interface{}, error) {
+	targetID, err := strconv.ParseUint(req.TargetID, 10, 32)
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "无效的目标ID")
+	}
+
+	var conversationKey string
+	switch req.ConversationType {
+	case models.MessageTypePrivate:
+		if err := checkFriend(userID, uint(targetID)); err != nil {
+			return nil, err
+		}
+		conversationKey = models.PrivateConversationKey(userID, uint(targetID))
+	case models.MessageTypeGroup:
+		if _, _, err := checkGroupMember(uint(targetID), userID); err != nil {
+			return nil, err
+		}
+		conversationKey = models.GroupConversationKey(uint(targetID))
+	default:
+		return nil, newRequestError(http.StatusBadRequest, "无效的会话类型")
+	}
+
+	message, err := models.GetMessageByID(req.MessageID)
+	if err != nil || message.ConversationKey != conversationKey {
+		return nil, newRequestError(http.StatusBadRequest, "消息不属于该会话")
+	}
+
+	previous, advanced, err := models.MarkConversationRead(conversationKey, userID, message.ID)
+	if err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "标记已读失败")
+	}
+
+	lastReadMessageID := message.ID
+	if !advanced {
+		lastReadMessageID = previous
+	}
+	result := map[string]interface{}{
+		"conversationKey":   conversationKey,
+		"lastReadMessageId": lastReadMessageID,
+		"advanced":          advanced,
+	}
+	if !advanced {
+		return result, nil
+	}
+
+	event := map[string]interface{}{
+		"type":              "read",
+		"conversationType":  req.ConversationType,
+		"conversationKey":   conversationKey,
+		"userId":            userID,
+		"lastReadMessageId": message.ID,
+		"readAt":            time.Now(),
+	}
+	if req.ConversationType == models.MessageTypeGroup {
+		event["groupId"] = uint(targetID)
+	}
+
+	// 通知本次读到的消息的发送者，以及自己的其他设备
+	receiverIDs := []uint{userID}
+	if req.ConversationType == models.MessageTypePrivate {
+		receiverIDs = append(receiverIDs, uint(targetID))
+	} else {
+		senderIDs, err := models.GetSendersInRange(conversationKey, previous, message.ID, userID)
+		if err != nil {
+			return nil, newRequestError(http.StatusInternalServerError, "获取消息发送者失败")
+		}
+		receiverIDs = append(receiverIDs, senderIDs...)
+	}
+	for _, receiverID := range receiverIDs {
+		pushToUser(hub, receiverID, event)
+	}
+
+	return result, nil
+}
+
+// GetMessageReaders 获取已读某条消息的成员列表
+func GetMessageReaders(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	message, err := models.GetMessageByID(uint(messageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	participants, err := getConversationParticipants(message, uint(userID))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkMessageVisible(message, uint(userID)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cursors, err := models.GetMessageReaders(message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取已读成员失败"})
+		return
+	}
+
+	readerIDs := make([]uint, 0, len(cursors))
+	for _, cursor := range cursors {
+		readerIDs = append(readerIDs, cursor.UserID)
+	}
+	users, err := models.GetUsersByIDs(readerIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取已读成员失败"})
+		return
+	}
+	usersByID := make(map[uint]*models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	readers := make([]gin.H, 0, len(cursors))
+	for _, cursor := range cursors {
+		reader := gin.H{
+			"userId": cursor.UserID,
+			"readAt": cursor.ReadAt,
+		}
+		if user := usersByID[cursor.UserID]; user != nil {
+			reader["username"] = user.Username
+			reader["avatar"] = user.Avatar
+		}
+		readers = append(readers, reader)
+	}
+
+	// 除发送者外尚未读到该消息的人数
+	unreadCount := len(participants) - 1 - len(readers)
+	if unreadCount < 0 {
+		unreadCount = 0
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messageId":   message.ID,
+		"readCount":   len(readers),
+		"unreadCount": unreadCount,
+		"readers":     readers,
+	})
+}
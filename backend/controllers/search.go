@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/search"
+)
+
+// maxKeywordLength 搜索关键词的最大字符数
+const maxKeywordLength = 100
+
+// indexMessage 更新消息的搜索索引，失败只记录日志，不影响消息本身
+func indexMessage(message *models.Message) {
+	if err := search.Engine.Index(message); err != nil {
+		log.Printf("更新搜索索引失败: %v", err)
+	}
+}
+
+// unindexConversation 删除会话全部消息的搜索索引，失败只记录日志
+func unindexConversation(conversationKey string) {
+	if err := search.Engine.RemoveConversation(conversationKey); err != nil {
+		log.Printf("删除会话搜索索引失败: %v", err)
+	}
+}
+
+// SearchMessages 在当前用户所在的会话中全文搜索消息。
+// 支持按会话（conversationType、targetId）、发送者（senderId）和时间范围（from、to）过滤，
+// 结果按时间倒序，每条消息附带高亮片段
+func SearchMessages(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	keyword := c.Query("keyword")
+	if len(search.Terms(keyword)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入搜索关键词"})
+		return
+	}
+	if utf8.RuneCountInString(keyword) > maxKeywordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "搜索关键词过长"})
+		return
+	}
+
+	query := search.Query{Keyword: keyword}
+	query.ViewerID = uint(userID)
+
+	query.Limit = models.DefaultMessagePageSize
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页大小"})
+			return
+		}
+		query.Limit = l
+	}
+	if query.Limit > models.MaxMessagePageSize {
+		query.Limit = models.MaxMessagePageSize
+	}
+
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		beforeID, err := strconv.ParseUint(beforeStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页游标"})
+			return
+		}
+		query.BeforeID = uint(beforeID)
+	}
+
+	if senderStr := c.Query("senderId"); senderStr != "" {
+		senderID, err := strconv.ParseUint(senderStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的发送者ID"})
+			return
+		}
+		query.SenderID = uint(senderID)
+	}
+
+	if query.Since, err = parseSearchTime(c.Query("from"), false); err != nil {
+		respondError(c, err)
+		return
+	}
+	if query.Until, err = parseSearchTime(c.Query("to"), true); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 只能搜索当前所在的会话，指定会话时同样需要检查权限
+	if conversationType := c.Query("conversationType"); conversationType != "" {
+		targetID, err := strconv.ParseUint(c.Query("targetId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+			return
+		}
+		switch conversationType {
+		case models.MessageTypePrivate:
+			if err := checkFriend(uint(userID), uint(targetID)); err != nil {
+				respondError(c, err)
+				return
+			}
+			query.ConversationKeys = []string{models.PrivateConversationKey(uint(userID), uint(targetID))}
+		case models.MessageTypeGroup:
+			if _, _, err := checkGroupMember(uint(targetID), uint(userID)); err != nil {
+				respondError(c, err)
+				return
+			}
+			query.ConversationKeys = []string{models.GroupConversationKey(uint(targetID))}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话类型"})
+			return
+		}
+	} else {
+		query.ConversationKeys, err = models.GetSearchableConversationKeys(uint(userID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索消息失败"})
+			return
+		}
+	}
+
+	// 多取一条用于判断是否还有下一页
+	query.Limit++
+	ids, err := search.Engine.Search(query)
+	if err != nil {
+		log.Printf("搜索消息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索消息失败"})
+		return
+	}
+	hasMore := len(ids) >= query.Limit
+	if hasMore {
+		ids = ids[:query.Limit-1]
+	}
+
+	messages, err := models.GetMessagesByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索消息失败"})
+		return
+	}
+	messageList := make([]*models.Message, 0, len(messages))
+	for _, id := range ids {
+		// 索引可能晚于数据库更新，再次确认消息可以被搜索
+		if message, ok := messages[id]; ok && message.IsSearchable() {
+			messageList = append(messageList, message)
+		}
+	}
+	if err := decorateMessages(messageList, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索消息失败"})
+		return
+	}
+
+	results := make([]gin.H, 0, len(messageList))
+	for _, message := range messageList {
+		results = append(results, gin.H{
+			"message":    message,
+			"highlights": search.Highlight(message.Content, keyword),
+		})
+	}
+
+	var nextBefore uint
+	if hasMore {
+		nextBefore = ids[len(ids)-1]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":    results,
+		"hasMore":    hasMore,
+		"nextBefore": nextBefore,
+		// 没有更多结果时，索引中缺少的较早消息里可能还有匹配的结果
+		"truncated": !hasMore && search.Engine.Truncated(),
+	})
+}
+
+// parseSearchTime 解析时间范围参数，支持RFC3339和"2006-01-02"格式。
+// 只有日期的结束时间包含当天，返回第二天零点
+func parseSearchTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, newRequestError(http.StatusBadRequest, "无效的时间范围")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// syncLimitPerConversation 每次同步每个会话最多返回的变更数
+const syncLimitPerConversation = 100
+
+// syncConversation 用户参与的一个会话
+type syncConversation struct {
+	Key       string
+	Type      string
+	PeerID    uint
+	GroupID   uint
+	CreatedAt time.Time // 成为好友或群组创建的时间
+}
+
+// encodeSyncCursor 将各会话的序列号游标编码为不透明字符串
+func encodeSyncCursor(cursors map[string]uint64) string {
+	data, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSyncCursor 解析客户端传回的同步游标
+func decodeSyncCursor(cursor string) (map[string]uint64, error) {
+	cursors := make(map[string]uint64)
+	if cursor == "" {
+		return cursors, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, err
+	}
+	return cursors, nil
+}
+
+// getUserConversations 获取用户参与的全部私聊和群聊会话
+func getUserConversations(userID uint) ([]syncConversation, error) {
+	friendships, err := models.GetFriendships(userID, "accepted")
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := models.GetGroupsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := make([]syncConversation, 0, len(friendships)+len(groups))
+	for _, friendship := range friendships {
+		peerID := friendship.FriendID
+		if friendship.FriendID == userID {
+			peerID = friendship.UserID
+		}
+		conversations = append(conversations, syncConversation{
+			Key:       models.PrivateConversationKey(userID, peerID),
+			Type:      models.MessageTypePrivate,
+			PeerID:    peerID,
+			CreatedAt: friendship.CreatedAt,
+		})
+	}
+	for _, group := range groups {
+		conversations = append(conversations, syncConversation{
+			Key:       models.GroupConversationKey(group.ID),
+			Type:      models.MessageTypeGroup,
+			GroupID:   group.ID,
+			CreatedAt: group.CreatedAt,
+		})
+	}
+	return conversations, nil
+}
+
+// Sync 增量同步：返回各会话中客户端游标之后的全部消息变更
+func Sync(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	cursors, err := decodeSyncCursor(c.Query("since"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的同步游标"})
+		return
+	}
+
+	conversations, err := getUserConversations(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	nextCursors := make(map[string]uint64, len(conversations))
+	response := make([]gin.H, 0)
+	hasMore := false
+	for _, conversation := range conversations {
+		since := cursors[conversation.Key]
+		nextCursors[conversation.Key] = since
+
+		changes, err := models.GetChangesSince(conversation.Key, uint(userID), since, syncLimitPerConversation+1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话变更失败"})
+			return
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		conversationHasMore := len(changes) > syncLimitPerConversation
+		if conversationHasMore {
+			changes = changes[:syncLimitPerConversation]
+			hasMore = true
+		}
+
+		messageIDs := make([]uint, 0, len(changes))
+		for _, change := range changes {
+			messageIDs = append(messageIDs, change.MessageID)
+		}
+		messages, err := models.GetMessagesByIDs(messageIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+			return
+		}
+		messageList := make([]*models.Message, 0, len(messages))
+		for _, message := range messages {
+			messageList = append(messageList, message)
+		}
+		if err := decorateMessages(messageList, uint(userID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+			return
+		}
+
+		// 跳过用户"仅对自己删除"的消息
+		hidden, err := models.GetHiddenMessageIDs(uint(userID), messageIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+			return
+		}
+
+		items := make([]gin.H, 0, len(changes))
+		for _, change := range changes {
+			// 删除只需要告诉客户端消息ID，客户端据此移除本地的消息
+			if change.Kind == models.ChangeKindHidden {
+				items = append(items, gin.H{
+					"seq":       change.Seq,
+					"kind":      change.Kind,
+					"messageId": change.MessageID,
+				})
+				continue
+			}
+			if hidden[change.MessageID] {
+				continue
+			}
+			items = append(items, gin.H{
+				"seq":       change.Seq,
+				"kind":      change.Kind,
+				"messageId": change.MessageID,
+				"message":   messages[change.MessageID],
+			})
+		}
+		nextCursors[conversation.Key] = changes[len(changes)-1].Seq
+
+		response = append(response, gin.H{
+			"conversationKey": conversation.Key,
+			"type":            conversation.Type,
+			"peerId":          conversation.PeerID,
+			"groupId":         conversation.GroupID,
+			"changes":         items,
+			"hasMore":         conversationHasMore,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": response,
+		"cursor":        encodeSyncCursor(nextCursors),
+		"hasMore":       hasMore,
+	})
+}
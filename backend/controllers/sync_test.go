@@ -0,0 +1,29 @@
+package controllers
+
+import "testing"
+
+func TestSyncCursorRoundTrip(t *testing.T) {
+	tests := []map[string]uint64{
+		{},
+		{"p_1_2": 5},
+		{"p_1_2": 5, "g_3": 100},
+	}
+	for _, cursors := range tests {
+		decoded, err := decodeSyncCursor(encodeSyncCursor(cursors))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != len(cursors) {
+			t.Fatalf("decoded = %v, want %v", decoded, cursors)
+		}
+		for key, seq := range cursors {
+			if decoded[key] != seq {
+				t.Errorf("decoded[%q] = %d, want %d", key, decoded[key], seq)
+			}
+		}
+	}
+
+	if _, err := decodeSyncCursor("not-base64!"); err == nil {
+		t.Error("decodeSyncCursor accepted an invalid cursor")
+	}
+}
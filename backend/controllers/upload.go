@@ -0,0 +1,477 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/media"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/storage"
+)
+
+// maxFileNameLength 文件名的最大字符数
+const maxFileNameLength = 255
+
+// uploadCleanupInterval 清理过期分片上传会话的间隔
+const uploadCleanupInterval = time.Hour
+
+// CreateUploadSessionRequest 创建分片上传会话请求
+type CreateUploadSessionRequest struct {
+	FileName string `json:"fileName" binding:"required"`
+	Size     int64  `json:"size" binding:"required"`
+}
+
+// uploadLockStripes 分片上传会话锁的数量，会话按ID的哈希值共用固定数量的锁，不会随会话数增长
+const uploadLockStripes = 64
+
+// uploadLocks 同一分片上传会话的请求串行处理，避免并发写入暂存文件
+var uploadLocks [uploadLockStripes]sync.Mutex
+
+// lockUploadSession 锁定分片上传会话，返回解锁函数。调用方需要先确认会话存在且属于当前用户
+func lockUploadSession(id string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	mu := &uploadLocks[h.Sum32()%uploadLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// UploadFile 通过multipart表单一次性上传文件，表单字段名为file
+func UploadFile(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	// 限制请求体大小，为表单的其他部分预留空间
+	maxSize := config.AppConfig.Upload.MaxSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
+	}
+	if fileHeader.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := storeAttachment(c.Request.Context(), uint(userID), fileHeader.Filename, file, fileHeader.Size)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "上传成功",
+		"data":    attachment,
+	})
+}
+
+// CreateUploadSession 创建分片上传会话，客户端随后按顺序上传分片
+func CreateUploadSession(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+	if req.Size <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件大小"})
+		return
+	}
+	if req.Size > config.AppConfig.Upload.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+		return
+	}
+
+	id, err := newUploadSessionID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传会话失败"})
+		return
+	}
+
+	// 创建空的暂存文件
+	if err := os.MkdirAll(config.AppConfig.Upload.TempDir, 0o755); err != nil {
+		log.Printf("创建上传暂存目录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传会话失败"})
+		return
+	}
+	file, err := os.Create(uploadTempPath(id))
+	if err != nil {
+		log.Printf("创建上传暂存文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传会话失败"})
+		return
+	}
+	file.Close()
+
+	session := &models.UploadSession{
+		ID:         id,
+		UploaderID: uint(userID),
+		FileName:   cleanFileName(req.FileName),
+		Size:       req.Size,
+		ExpiresAt:  time.Now().Add(config.AppConfig.Upload.SessionTTL),
+	}
+	if err := models.CreateUploadSession(session); err != nil {
+		os.Remove(uploadTempPath(id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "上传会话已创建",
+		"data":      session,
+		"chunkSize": config.AppConfig.Upload.ChunkSize,
+	})
+}
+
+// GetUploadSession 查询分片上传会话的进度，断线后客户端从返回的offset继续上传
+func GetUploadSession(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	session, err := models.GetUploadSession(c.Param("id"), uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在或已过期"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": session})
+}
+
+// UploadChunk 上传一个分片，请求体为分片的原始内容，offset参数为分片在文件中的起始位置。
+// 最后一个分片上传完成后返回创建的附件
+func UploadChunk(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的offset"})
+		return
+	}
+
+	sessionID := c.Param("id")
+	if _, err := models.GetUploadSession(sessionID, uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在或已过期"})
+		return
+	}
+	unlock := lockUploadSession(sessionID)
+	defer unlock()
+
+	// 等待锁期间会话可能已经前进、完成或被取消，需要重新读取
+	session, err := models.GetUploadSession(sessionID, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在或已过期"})
+		return
+	}
+
+	// 分片必须从已接收的位置开始，重复或跳跃的分片返回当前进度
+	if offset != session.Offset {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "分片位置不匹配",
+			"offset": session.Offset,
+		})
+		return
+	}
+
+	written, err := appendChunk(session, c.Request.Body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	advanced, err := models.AdvanceUploadSession(session, session.Offset+written)
+	if err != nil || !advanced {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存上传进度失败"})
+		return
+	}
+
+	if session.Offset < session.Size {
+		c.JSON(http.StatusOK, gin.H{"data": session})
+		return
+	}
+
+	// 全部分片已接收，保存为附件
+	attachment, err := completeUploadSession(c.Request.Context(), session)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "上传成功",
+		"data":       session,
+		"attachment": attachment,
+	})
+}
+
+// CancelUploadSession 取消分片上传会话并删除暂存文件
+func CancelUploadSession(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	sessionID := c.Param("id")
+	if _, err := models.GetUploadSession(sessionID, uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在或已过期"})
+		return
+	}
+	unlock := lockUploadSession(sessionID)
+	defer unlock()
+
+	// 等待锁期间会话可能已经前进、完成或被取消，需要重新读取
+	session, err := models.GetUploadSession(sessionID, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在或已过期"})
+		return
+	}
+
+	removeUploadSession(session.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "上传已取消"})
+}
+
+// appendChunk 将分片追加到暂存文件，返回写入的字节数
+func appendChunk(session *models.UploadSession, body io.Reader) (int64, error) {
+	file, err := os.OpenFile(uploadTempPath(session.ID), os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("打开上传暂存文件失败: %v", err)
+		return 0, newRequestError(http.StatusInternalServerError, "保存分片失败")
+	}
+	defer file.Close()
+
+	// 丢弃上次中断的请求写入的多余内容
+	if err := file.Truncate(session.Offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(session.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// 多读一个字节，用于判断分片是否超出文件大小
+	remaining := session.Size - session.Offset
+	written, err := io.Copy(file, io.LimitReader(body, remaining+1))
+	if err != nil {
+		file.Truncate(session.Offset)
+		return 0, newRequestError(http.StatusBadRequest, "读取分片失败")
+	}
+	if written > remaining {
+		file.Truncate(session.Offset)
+		return 0, newRequestError(http.StatusBadRequest, "分片超出文件大小")
+	}
+	if written == 0 {
+		return 0, newRequestError(http.StatusBadRequest, "分片内容为空")
+	}
+	return written, nil
+}
+
+// completeUploadSession 将接收完整的暂存文件保存为附件，并删除上传会话
+func completeUploadSession(ctx context.Context, session *models.UploadSession) (*models.Attachment, error) {
+	file, err := os.Open(uploadTempPath(session.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	attachment, err := storeAttachment(ctx, session.UploaderID, session.FileName, file, session.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	removeUploadSession(session.ID)
+	return attachment, nil
+}
+
+// storeAttachment 检查文件类型，按内容哈希写入存储并创建附件记录。
+// 内容相同的文件只在存储中保存一份
+func storeAttachment(ctx context.Context, uploaderID uint, fileName string, file io.ReadSeeker, size int64) (*models.Attachment, error) {
+	// 根据文件内容判断类型，不信任客户端声明的Content-Type
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, newRequestError(http.StatusBadRequest, "读取文件失败")
+	}
+	contentType := http.DetectContentType(head[:n])
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	if !allowedContentType(contentType) {
+		return nil, newRequestError(http.StatusUnsupportedMediaType, "不支持的文件类型")
+	}
+
+	// 计算内容哈希
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	hashed, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "读取文件失败")
+	}
+	if hashed != size {
+		return nil, newRequestError(http.StatusBadRequest, "文件大小不匹配")
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	key := models.BlobStorageKey(sum)
+
+	exists, err := storage.Store.Exists(ctx, key)
+	if err != nil {
+		log.Printf("检查存储对象失败: %v", err)
+		return nil, newRequestError(http.StatusInternalServerError, "保存文件失败")
+	}
+	if !exists {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := storage.Store.Put(ctx, key, file, size, contentType); err != nil {
+			log.Printf("写入存储失败: %v", err)
+			return nil, newRequestError(http.StatusInternalServerError, "保存文件失败")
+		}
+	}
+
+	attachment := &models.Attachment{
+		UploaderID:  uploaderID,
+		Kind:        models.AttachmentKindOf(contentType),
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      sum,
+		StorageKey:  key,
+	}
+	if media.CanProcess(contentType) {
+		attachment.MediaStatus = models.MediaStatusPending
+	}
+	if err := models.CreateAttachment(attachment); err != nil {
+		return nil, newRequestError(http.StatusInternalServerError, "保存文件失败")
+	}
+
+	// 图片在后台生成缩略图，完成后推送attachment_updated事件
+	if attachment.MediaStatus == models.MediaStatusPending {
+		media.EnqueueAttachment(attachment.ID)
+	}
+	return attachment, nil
+}
+
+// allowedContentType 检查MIME类型是否在允许列表中，以"/"结尾的配置项匹配整个大类
+func allowedContentType(contentType string) bool {
+	for _, allowed := range config.AppConfig.Upload.AllowedTypes {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == contentType || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(contentType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanFileName 去掉文件名中的路径和控制字符，并限制长度
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if utf8.RuneCountInString(name) > maxFileNameLength {
+		name = string([]rune(name)[:maxFileNameLength])
+	}
+	return name
+}
+
+// newUploadSessionID 生成随机的上传会话ID
+func newUploadSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// uploadTempPath 上传会话暂存文件的路径
+func uploadTempPath(id string) string {
+	return filepath.Join(config.AppConfig.Upload.TempDir, id+".part")
+}
+
+// removeUploadSession 删除上传会话及其暂存文件
+func removeUploadSession(id string) {
+	if err := models.DeleteUploadSession(id); err != nil {
+		log.Printf("删除上传会话失败: %v", err)
+	}
+	if err := os.Remove(uploadTempPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("删除上传暂存文件失败: %v", err)
+	}
+}
+
+// StartUploadCleanup 定期清理过期的分片上传会话
+func StartUploadCleanup() {
+	go func() {
+		ticker := time.NewTicker(uploadCleanupInterval)
+		defer ticker.Stop()
+		for {
+			cleanupUploadSessions()
+			<-ticker.C
+		}
+	}()
+}
+
+// cleanupUploadSessions 删除过期的分片上传会话及其暂存文件
+func cleanupUploadSessions() {
+	for {
+		sessions, err := models.GetExpiredUploadSessions(100)
+		if err != nil {
+			log.Printf("获取过期上传会话失败: %v", err)
+			return
+		}
+		for _, session := range sessions {
+			removeUploadSession(session.ID)
+		}
+		if len(sessions) < 100 {
+			return
+		}
+	}
+}
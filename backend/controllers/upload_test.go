@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockUploadSession(t *testing.T) {
+	unlock := lockUploadSession("session-a")
+
+	acquired := make(chan struct{})
+	go func() {
+		defer lockUploadSession("session-a")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("same session locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock was not released")
+	}
+
+}
@@ -3,17 +3,32 @@ package controllers
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/gin-vue-chat/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// UpdateProfileRequest 更新用户资料请求
+const (
+	maxNicknameLength  = 50  // 昵称的最大字符数
+	maxBioLength       = 200 // 个人简介的最大字符数
+	maxRegionLength    = 50  // 地区的最大字符数
+	maxSignatureLength = 50  // 个性签名的最大字符数
+)
+
+// UpdateProfileRequest 更新用户资料请求，为nil的字段保持不变，为空字符串时清除
 type UpdateProfileRequest struct {
-	Email  string `json:"email" binding:"omitempty,email"`
-	Avatar string `json:"avatar"`
-	Status string `json:"status" binding:"omitempty,oneof=online offline away"`
+	Email     string  `json:"email" binding:"omitempty,email"`
+	Avatar    string  `json:"avatar"`
+	Nickname  *string `json:"nickname"`
+	Bio       *string `json:"bio"`
+	Gender    *string `json:"gender"`   // male, female, other
+	Birthday  *string `json:"birthday"` // YYYY-MM-DD
+	Region    *string `json:"region"`
+	Signature *string `json:"signature"`
 }
 
 // ChangePasswordRequest 修改密码请求
@@ -38,13 +53,7 @@ func GetUserProfile(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"avatar":   user.Avatar,
-			"status":   user.Status,
-		},
+		"user": selfProfile(user),
 	})
 }
 
@@ -86,8 +95,40 @@ func UpdateUserProfile(c *gin.Context) {
 		user.Avatar = req.Avatar
 	}
 
-	if req.Status != "" {
-		user.Status = req.Status
+	if err := applyProfileText(&user.Nickname, req.Nickname, maxNicknameLength, "昵称过长"); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := applyProfileText(&user.Bio, req.Bio, maxBioLength, "个人简介过长"); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := applyProfileText(&user.Region, req.Region, maxRegionLength, "地区过长"); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := applyProfileText(&user.Signature, req.Signature, maxSignatureLength, "个性签名过长"); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if req.Gender != nil {
+		if !models.ValidGender(*req.Gender) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的性别"})
+			return
+		}
+		user.Gender = *req.Gender
+	}
+
+	if req.Birthday != nil {
+		if *req.Birthday != "" {
+			birthday, err := time.Parse("2006-01-02", *req.Birthday)
+			if err != nil || birthday.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的生日"})
+				return
+			}
+		}
+		user.Birthday = *req.Birthday
 	}
 
 	err = models.UpdateUser(user)
@@ -98,16 +139,45 @@ func UpdateUserProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "用户资料已更新",
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"avatar":   user.Avatar,
-			"status":   user.Status,
-		},
+		"user":    selfProfile(user),
 	})
 }
 
+// applyProfileText 去掉资料文本两端的空白并检查长度，value为nil时保持不变
+func applyProfileText(field *string, value *string, maxLength int, tooLong string) error {
+	if value == nil {
+		return nil
+	}
+	text := strings.TrimSpace(*value)
+	if utf8.RuneCountInString(text) > maxLength {
+		return newRequestError(http.StatusBadRequest, tooLong)
+	}
+	*field = text
+	return nil
+}
+
+// selfProfile 用户自己的完整资料，包含邮箱和隐私设置
+func selfProfile(user *models.User) gin.H {
+	return gin.H{
+		"id":         user.ID,
+		"username":   user.Username,
+		"email":      user.Email,
+		"avatar":     user.Avatar,
+		"nickname":   user.Nickname,
+		"bio":        user.Bio,
+		"gender":     user.Gender,
+		"birthday":   user.Birthday,
+		"region":     user.Region,
+		"signature":  user.Signature,
+		"status":     user.Status,
+		"lastSeenAt": user.LastSeenAt,
+		"privacy": gin.H{
+			"findByUsername": user.FindByUsername,
+			"findByEmail":    user.FindByEmail,
+		},
+	}
+}
+
 // ChangePassword 修改密码
 func ChangePassword(c *gin.Context) {
 	userIDStr := c.GetString("userId")
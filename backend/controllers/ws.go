@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// WebSocket入站帧类型
+const (
+	wsTypeSendPrivate = "message.private" // 发送私聊消息
+	wsTypeSendGroup   = "message.group"   // 发送群聊消息
+	wsTypeMarkRead    = "message.read"    // 标记消息已读
+	wsTypeAck         = "message.ack"     // 确认收到消息
+	wsTypeReplay      = "message.replay"  // 拉取下一批离线消息
+	wsTypeTyping      = "typing"          // 正在输入
+	wsTypeRecording   = "recording"       // 正在录制语音
+)
+
+// replayBatchSize 每批补发的离线消息数量
+const replayBatchSize = 100
+
+// wsAckPayload 确认收到帧的负载
+type wsAckPayload struct {
+	MessageIDs []uint `json:"messageIds"`
+}
+
+// wsEphemeralPayload 正在输入、正在录音等瞬时事件帧的负载
+type wsEphemeralPayload struct {
+	ConversationType string `json:"conversationType"` // private, group
+	TargetID         string `json:"targetId"`         // 私聊为对方用户ID，群聊为群组ID
+	Active           bool   `json:"active"`           // true表示开始或保持，false表示结束
+}
+
+// RegisterWSHandlers 注册WebSocket入站帧的处理器
+func RegisterWSHandlers(hub *websocket.Hub) {
+	hub.Handle(wsTypeSendPrivate, wsSendPrivateMessage)
+	hub.Handle(wsTypeSendGroup, wsSendGroupMessage)
+	hub.Handle(wsTypeMarkRead, wsMarkRead)
+	hub.Handle(wsTypeAck, wsAck)
+	hub.Handle(wsTypeReplay, wsReplay)
+	hub.Handle(wsTypeTyping, wsEphemeral(wsTypeTyping))
+	hub.Handle(wsTypeRecording, wsEphemeral(wsTypeRecording))
+
+	// 客户端连接后补发离线期间未确认的消息
+	hub.OnRegister(replayQueuedMessages)
+
+	// 在线状态由连接和心跳维护
+	hub.OnPresenceChange(presenceChangeHandler(hub))
+
+	// 屏蔽关系用于过滤在线状态和瞬时事件
+	loadBlockList(hub)
+}
+
+// wsClientUserID 解析WebSocket客户端的用户ID
+func wsClientUserID(c *websocket.Client) (uint, error) {
+	userID, err := strconv.ParseUint(c.UserID, 10, 32)
+	if err != nil {
+		return 0, websocket.NewError(websocket.ErrCodeBadRequest, "无效的用户ID")
+	}
+	return uint(userID), nil
+}
+
+// decodeWSPayload 解析帧负载
+func decodeWSPayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return websocket.NewError(websocket.ErrCodeBadRequest, "缺少消息负载")
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return websocket.NewError(websocket.ErrCodeBadRequest, "请求参数无效")
+	}
+	return nil
+}
+
+// wsSendPrivateMessage 通过WebSocket发送私聊消息
+func wsSendPrivateMessage(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	senderID, err := wsClientUserID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var req SendPrivateMessageRequest
+	if err := decodeWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	message, err := sendPrivateMessage(c.Hub, senderID, &req)
+	if err != nil {
+		return nil, toWSError(err)
+	}
+	return message, nil
+}
+
+// wsSendGroupMessage 通过WebSocket发送群聊消息
+func wsSendGroupMessage(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	senderID, err := wsClientUserID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var req SendGroupMessageRequest
+	if err := decodeWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	message, err := sendGroupMessage(c.Hub, senderID, &req)
+	if err != nil {
+		return nil, toWSError(err)
+	}
+	return message, nil
+}
+
+// wsMarkRead 通过WebSocket推进会话的已读位置
+func wsMarkRead(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	userID, err := wsClientUserID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var req MarkReadRequest
+	if err := decodeWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.ConversationType == "" || req.TargetID == "" || req.MessageID == 0 {
+		return nil, websocket.NewError(websocket.ErrCodeBadRequest, "请求参数无效")
+	}
+
+	result, err := markConversationRead(c.Hub, userID, &req)
+	if err != nil {
+		return nil, toWSError(err)
+	}
+	return result, nil
+}
+
+// wsAck 确认收到消息，并通知发送者消息已送达
+func wsAck(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	userID, err := wsClientUserID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var req wsAckPayload
+	if err := decodeWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+	if len(req.MessageIDs) == 0 {
+		return nil, websocket.NewError(websocket.ErrCodeBadRequest, "无效的消息ID")
+	}
+
+	messages, err := models.MarkDelivered(userID, req.MessageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveredAt := time.Now()
+	for _, message := range messages {
+		pushToUser(c.Hub, message.SenderID, map[string]interface{}{
+			"type":             "delivered",
+			"messageId":        message.ID,
+			"conversationType": message.Type,
+			"userId":           userID,
+			"deliveredAt":      deliveredAt,
+		})
+	}
+
+	return map[string]interface{}{"delivered": len(messages)}, nil
+}
+
+// wsReplay 拉取下一批未确认的离线消息，客户端应先确认上一批再拉取
+func wsReplay(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	userID, err := wsClientUserID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	events, hasMore, err := loadQueuedMessageEvents(userID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"messages": events, "hasMore": hasMore}, nil
+}
+
+// replayQueuedMessages 客户端注册后推送第一批离线消息
+func replayQueuedMessages(c *websocket.Client) {
+	userID, err := wsClientUserID(c)
+	if err != nil {
+		return
+	}
+
+	events, hasMore, err := loadQueuedMessageEvents(userID)
+	if err != nil {
+		log.Printf("加载离线消息失败: %v", err)
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":     "offline",
+			"messages": events,
+			"hasMore":  hasMore,
+		},
+	})
+	if err != nil {
+		log.Printf("消息序列化失败: %v", err)
+		return
+	}
+	c.SendMessage(jsonData)
+}
+
+// loadQueuedMessageEvents 加载用户一批未确认的消息并构建为推送事件
+func loadQueuedMessageEvents(userID uint) ([]map[string]interface{}, bool, error) {
+	messages, err := models.GetQueuedMessages(userID, replayBatchSize+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > replayBatchSize
+	if hasMore {
+		messages = messages[:replayBatchSize]
+	}
+	if err := decorateMessages(messages, userID); err != nil {
+		return nil, false, err
+	}
+
+	settings, err := models.GetFriendSettings(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	senders := make(map[uint]*models.User)
+	events := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		sender, ok := senders[message.SenderID]
+		if !ok {
+			sender, _ = models.GetUserByID(message.SenderID)
+			senders[message.SenderID] = sender
+		}
+		event := buildMessageEvent(message, sender)
+		if setting, ok := settings[message.SenderID]; ok && setting.Alias != "" {
+			event = withSenderAlias(event, setting.Alias)
+		}
+		events = append(events, event)
+	}
+
+	return events, hasMore, nil
+}
+
+// wsEphemeral 创建瞬时事件的处理器，事件只转发给私聊对方或群组其他成员，不会持久化
+// 客户端需要在 websocket.EphemeralTTL 内重复发送以保持状态，超时后服务端自动结束
+func wsEphemeral(activity string) websocket.HandlerFunc {
+	return func(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+		userID, err := wsClientUserID(c)
+		if err != nil {
+			return nil, err
+		}
+
+		var req wsEphemeralPayload
+		if err := decodeWSPayload(payload, &req); err != nil {
+			return nil, err
+		}
+
+		targetID, err := strconv.ParseUint(req.TargetID, 10, 32)
+		if err != nil {
+			return nil, websocket.NewError(websocket.ErrCodeBadRequest, "无效的目标ID")
+		}
+
+		var conversationKey string
+		var recipients []string
+		switch req.ConversationType {
+		case models.MessageTypePrivate:
+			if err := checkFriend(userID, uint(targetID)); err != nil {
+				return nil, toWSError(err)
+			}
+			conversationKey = models.PrivateConversationKey(userID, uint(targetID))
+			recipients = []string{req.TargetID}
+		case models.MessageTypeGroup:
+			_, members, err := checkGroupMember(uint(targetID), userID)
+			if err != nil {
+				return nil, toWSError(err)
+			}
+			conversationKey = models.GroupConversationKey(uint(targetID))
+			for _, member := range members {
+				if member.UserID != userID {
+					recipients = append(recipients, strconv.FormatUint(uint64(member.UserID), 10))
+				}
+			}
+		default:
+			return nil, toWSError(newRequestError(http.StatusBadRequest, "无效的会话类型"))
+		}
+
+		if !req.Active {
+			c.Hub.StopEphemeral(c.UserID, conversationKey, activity)
+			return nil, nil
+		}
+
+		c.Hub.StartEphemeral(&websocket.Ephemeral{
+			UserID:          c.UserID,
+			ConversationKey: conversationKey,
+			Activity:        activity,
+			Fields: map[string]interface{}{
+				"from":             userID,
+				"conversationType": req.ConversationType,
+				"targetId":         targetID,
+			},
+		}, recipients)
+		return map[string]interface{}{"expiresIn": websocket.EphemeralTTL.Milliseconds()}, nil
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/gin-vue-chat/config"
 	"github.com/yourusername/gin-vue-chat/controllers"
+	"github.com/yourusername/gin-vue-chat/media"
 	"github.com/yourusername/gin-vue-chat/middlewares"
 	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/search"
+	"github.com/yourusername/gin-vue-chat/storage"
 	"github.com/yourusername/gin-vue-chat/websocket"
 )
 
@@ -21,13 +24,32 @@ func main() {
 	// 初始化数据库
 	models.InitDB()
 
+	// 在线状态由WebSocket连接维护，启动时清除上次运行遗留的状态
+	if err := models.ResetPresence(); err != nil {
+		log.Printf("重置在线状态失败: %v", err)
+	}
+
+	// 初始化文件存储
+	storage.InitStorage()
+	controllers.StartUploadCleanup()
+
+	// 定期清理过期的好友请求和好友推荐缓存
+	controllers.StartFriendRequestExpiry()
+	controllers.StartFriendSuggestionCleanup()
+
+	// 启动图片处理管道
+	media.InitPipeline()
+
+	// 初始化消息搜索
+	search.InitSearch()
+
 	// 创建Gin实例
 	r := gin.Default()
 
 	// 配置CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     config.AppConfig.CORS.AllowOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
@@ -36,6 +58,8 @@ func main() {
 
 	// 初始化WebSocket管理器
 	hub := websocket.NewHub()
+	controllers.RegisterWSHandlers(hub)
+	controllers.RegisterMediaHandlers(hub)
 	go hub.Run()
 
 	// 将WebSocket Hub添加到Gin上下文中
@@ -53,6 +77,9 @@ func main() {
 			auth.POST("/register", controllers.Register)
 			auth.POST("/login", controllers.Login)
 		}
+
+		// 头像图片，地址由内容哈希生成，不需要认证
+		public.GET("/avatars/:file", controllers.GetAvatar)
 	}
 
 	// 需要认证的路由组
@@ -65,6 +92,22 @@ func main() {
 			user.GET("/profile", controllers.GetUserProfile)
 			user.PUT("/profile", controllers.UpdateUserProfile)
 			user.PUT("/password", controllers.ChangePassword)
+			user.POST("/avatar", controllers.UploadUserAvatar)
+			user.PUT("/privacy", controllers.UpdatePrivacySettings)
+		}
+
+		// 用户目录相关路由
+		users := protected.Group("/users")
+		{
+			users.GET("/search", controllers.SearchUsers)
+			users.GET("/:id", controllers.GetPublicProfile)
+		}
+
+		// 在线设备相关路由
+		devices := protected.Group("/devices")
+		{
+			devices.GET("", controllers.GetDevices)
+			devices.DELETE("/:deviceId", controllers.CloseDevice)
 		}
 
 		// 好友相关路由
@@ -72,9 +115,26 @@ func main() {
 		{
 			friends.GET("", controllers.GetFriends)
 			friends.POST("/add", controllers.AddFriend)
+			friends.GET("/requests/incoming", controllers.GetIncomingFriendRequests)
+			friends.GET("/requests/outgoing", controllers.GetOutgoingFriendRequests)
+			friends.POST("/requests/:id/accept", controllers.AcceptFriendRequest)
+			friends.POST("/requests/:id/reject", controllers.RejectFriendRequest)
+			friends.DELETE("/requests/:id", controllers.CancelFriendRequest)
+			friends.GET("/suggestions", controllers.GetFriendSuggestions)
+			friends.POST("/suggestions/:userId/dismiss", controllers.DismissFriendSuggestion)
+			friends.GET("/tags", controllers.GetFriendTags)
+			friends.PUT("/:id/settings", controllers.UpdateFriendSettings)
 			friends.DELETE("/:id", controllers.RemoveFriend)
 		}
 
+		// 屏蔽用户相关路由
+		blocks := protected.Group("/blocks")
+		{
+			blocks.GET("", controllers.GetBlockedUsers)
+			blocks.POST("", controllers.BlockUser)
+			blocks.DELETE("/:userId", controllers.UnblockUser)
+		}
+
 		// 群组相关路由
 		groups := protected.Group("/groups")
 		{
@@ -83,6 +143,8 @@ func main() {
 			groups.GET("/:id", controllers.GetGroupDetail)
 			groups.PUT("/:id", controllers.UpdateGroup)
 			groups.DELETE("/:id", controllers.DeleteGroup)
+			groups.POST("/:id/avatar", controllers.UploadGroupAvatar)
+			groups.POST("/:id/transfer", controllers.TransferGroup)
 			groups.GET("/:id/members", controllers.GetGroupMembers)
 			groups.POST("/:id/members", controllers.AddGroupMember)
 			groups.DELETE("/:id/members/:userId", controllers.RemoveGroupMember)
@@ -95,6 +157,53 @@ func main() {
 			messages.POST("/private", controllers.SendPrivateMessage)
 			messages.GET("/group/:groupId", controllers.GetGroupMessages)
 			messages.POST("/group", controllers.SendGroupMessage)
+			messages.GET("/thread/:rootId", controllers.GetThreadMessages)
+			messages.PUT("/:id", controllers.EditMessage)
+			messages.GET("/:id/revisions", controllers.GetMessageRevisions)
+			messages.POST("/:id/recall", controllers.RecallMessage)
+			messages.DELETE("/:id", controllers.DeleteMessageForMe)
+			messages.POST("/read", controllers.MarkMessagesAsRead)
+			messages.GET("/:id/readers", controllers.GetMessageReaders)
+			messages.POST("/:id/reactions", controllers.AddReaction)
+			messages.DELETE("/:id/reactions/:emoji", controllers.RemoveReaction)
+		}
+
+		// 会话列表相关路由
+		conversations := protected.Group("/conversations")
+		{
+			conversations.GET("", controllers.GetConversations)
+			conversations.PUT("/:type/:targetId", controllers.UpdateConversation)
+		}
+
+		// 增量同步路由
+		protected.GET("/sync", controllers.Sync)
+
+		// 消息搜索路由
+		protected.GET("/search/messages", controllers.SearchMessages)
+
+		// @提及相关路由
+		mentions := protected.Group("/mentions")
+		{
+			mentions.GET("", controllers.GetUnreadMentions)
+			mentions.POST("/read", controllers.MarkMentionsRead)
+		}
+
+		// 文件上传相关路由
+		uploads := protected.Group("/uploads")
+		{
+			uploads.POST("", controllers.UploadFile)
+			uploads.POST("/sessions", controllers.CreateUploadSession)
+			uploads.GET("/sessions/:id", controllers.GetUploadSession)
+			uploads.PATCH("/sessions/:id", controllers.UploadChunk)
+			uploads.DELETE("/sessions/:id", controllers.CancelUploadSession)
+		}
+
+		// 附件相关路由
+		attachments := protected.Group("/attachments")
+		{
+			attachments.GET("/:id", controllers.GetAttachment)
+			attachments.GET("/:id/download", controllers.DownloadAttachment)
+			attachments.GET("/:id/thumbnail", controllers.GetAttachmentThumbnail)
 		}
 	}
 
@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io"
+	"log"
+
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/storage"
+)
+
+// processAttachment 为图片附件生成缩略图、去除元数据并记录尺寸和占位图，返回处理后的附件。
+// 附件不存在或不需要处理时返回nil
+func processAttachment(attachmentID uint) *models.Attachment {
+	attachment, err := models.GetAttachmentByID(attachmentID)
+	if err != nil || attachment.MediaStatus != models.MediaStatusPending {
+		return nil
+	}
+
+	if err := fillAttachmentMedia(attachment); err != nil {
+		log.Printf("处理图片附件失败: %d: %v", attachment.ID, err)
+		attachment.MediaStatus = models.MediaStatusFailed
+	} else {
+		attachment.MediaStatus = models.MediaStatusReady
+	}
+
+	if err := models.UpdateAttachmentMedia(attachment); err != nil {
+		log.Printf("保存图片处理结果失败: %d: %v", attachment.ID, err)
+		return nil
+	}
+	return attachment
+}
+
+// fillAttachmentMedia 生成缩略图等处理结果并写入附件字段
+func fillAttachmentMedia(attachment *models.Attachment) error {
+	// 内容相同的图片已经处理过时直接复用结果
+	if processed, err := models.GetProcessedAttachment(attachment.SHA256); err == nil {
+		attachment.StorageKey = processed.StorageKey
+		attachment.Size = processed.Size
+		attachment.Width = processed.Width
+		attachment.Height = processed.Height
+		attachment.BlurHash = processed.BlurHash
+		attachment.DominantColor = processed.DominantColor
+		attachment.Thumbnails = processed.Thumbnails
+		return nil
+	}
+
+	ctx := context.Background()
+	data, err := readObject(ctx, attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.AppConfig.Media
+	img, format, err := decodeImage(data, cfg.MaxPixels)
+	if err != nil {
+		return err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	// 记录按正常方向显示时的尺寸
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	attachment.Width = width
+	attachment.Height = height
+
+	// 去除元数据后替换原图，原始上传内容不再对外提供
+	sanitized, err := sanitizeOriginal(data, img, format)
+	if err != nil {
+		return err
+	}
+	if sanitized != nil {
+		key := models.SanitizedStorageKey(attachment.SHA256)
+		if err := storage.Store.Put(ctx, key, bytes.NewReader(sanitized), int64(len(sanitized)), attachment.ContentType); err != nil {
+			return err
+		}
+		attachment.StorageKey = key
+		attachment.Size = int64(len(sanitized))
+	}
+
+	// 只生成比原图小的缩略图
+	longEdge := width
+	if height > longEdge {
+		longEdge = height
+	}
+	attachment.Thumbnails = nil
+	for _, size := range cfg.ThumbnailSizes {
+		if size >= longEdge {
+			continue
+		}
+		thumbnail, err := makeThumbnail(ctx, attachment.SHA256, img, orientation, width, height, size)
+		if err != nil {
+			return err
+		}
+		attachment.Thumbnails = append(attachment.Thumbnails, *thumbnail)
+	}
+
+	// 占位图和主色调在很小的图上计算即可
+	sampleW, sampleH := width, height
+	if longEdge > blurHashSampleSize {
+		sampleW, sampleH = fitSize(width, height, blurHashSampleSize)
+	}
+	sample := toRGBA(scaleOriented(img, orientation, sampleW, sampleH))
+	attachment.BlurHash = encodeBlurHash(sample)
+	attachment.DominantColor = dominantColor(sample)
+	return nil
+}
+
+// makeThumbnail 生成并保存一个规格的缩略图
+func makeThumbnail(ctx context.Context, sha256 string, img image.Image, orientation, width, height, size int) (*models.AttachmentThumbnail, error) {
+	thumbWidth, thumbHeight := fitSize(width, height, size)
+	data, contentType, err := encodeThumbnail(scaleOriented(img, orientation, thumbWidth, thumbHeight))
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.ThumbnailStorageKey(sha256, size, contentType)
+	if err := storage.Store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+	return &models.AttachmentThumbnail{
+		Size:        size,
+		Width:       thumbWidth,
+		Height:      thumbHeight,
+		ContentType: contentType,
+	}, nil
+}
+
+// scaleOriented 缩放到按正常方向显示时的目标尺寸。先缩放再旋转，避免旋转整张原图
+func scaleOriented(img image.Image, orientation, width, height int) image.Image {
+	if orientation >= 5 {
+		return orient(resize(img, height, width), orientation)
+	}
+	return orient(resize(img, width, height), orientation)
+}
+
+// readObject 读取存储中的对象
+func readObject(ctx context.Context, key string) ([]byte, error) {
+	reader, err := storage.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,136 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"regexp"
+
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/storage"
+)
+
+// 头像所属对象
+const (
+	AvatarTargetUser  = "user"
+	AvatarTargetGroup = "group"
+)
+
+// avatarQuality 头像的JPEG质量
+const avatarQuality = 85
+
+// avatarFilePattern 头像文件名：内容哈希_边长.jpg
+var avatarFilePattern = regexp.MustCompile(`^[0-9a-f]{64}_[0-9]+\.jpg$`)
+
+// AvatarJob 头像处理任务
+type AvatarJob struct {
+	Target     string // user, group
+	TargetID   uint
+	OperatorID uint   // 上传头像的用户
+	Data       []byte // 上传的原图
+}
+
+// AvatarResult 头像处理结果
+type AvatarResult struct {
+	Target     string
+	TargetID   uint
+	OperatorID uint
+	Avatar     string // 最大规格头像的地址
+}
+
+// CheckImage 检查上传的数据是否为可处理且尺寸在限制内的图片，只读取文件头
+func CheckImage(data []byte) error {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if !CanProcess("image/" + format) {
+		return fmt.Errorf("不支持的图片格式: %s", format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > config.AppConfig.Media.MaxPixels {
+		return fmt.Errorf("图片尺寸超出限制: %dx%d", cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// AvatarURL 头像的访问地址
+func AvatarURL(sum string, size int) string {
+	return fmt.Sprintf("/api/avatars/%s_%d.jpg", sum, size)
+}
+
+// AvatarStorageKey 根据头像文件名返回存储key，文件名无效时返回false
+func AvatarStorageKey(file string) (string, bool) {
+	if !avatarFilePattern.MatchString(file) {
+		return "", false
+	}
+	return "avatars/" + file[:2] + "/" + file, true
+}
+
+// processAvatar 将头像裁剪为正方形并生成各个规格，然后更新用户或群组的头像地址
+func processAvatar(avatar *AvatarJob) (*AvatarResult, error) {
+	img, format, err := decodeImage(avatar.Data, config.AppConfig.Media.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(avatar.Data)
+	}
+
+	hash := sha256.Sum256(avatar.Data)
+	sum := hex.EncodeToString(hash[:])
+
+	// 居中裁剪与旋转方向无关，可以在旋转前进行
+	square := cropSquare(img)
+	squareSize := square.Bounds().Dx()
+
+	ctx := context.Background()
+	largest := 0
+	for _, size := range config.AppConfig.Media.AvatarSizes {
+		edge := size
+		if edge > squareSize {
+			edge = squareSize
+		}
+
+		var buf bytes.Buffer
+		resized := flatten(orient(resize(square, edge, edge), orientation))
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: avatarQuality}); err != nil {
+			return nil, err
+		}
+
+		key, _ := AvatarStorageKey(fmt.Sprintf("%s_%d.jpg", sum, size))
+		if err := storage.Store.Put(ctx, key, &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+			return nil, err
+		}
+		if size > largest {
+			largest = size
+		}
+	}
+	if largest == 0 {
+		return nil, fmt.Errorf("未配置头像规格")
+	}
+
+	result := &AvatarResult{
+		Target:     avatar.Target,
+		TargetID:   avatar.TargetID,
+		OperatorID: avatar.OperatorID,
+		Avatar:     AvatarURL(sum, largest),
+	}
+	switch avatar.Target {
+	case AvatarTargetUser:
+		err = models.UpdateUserAvatar(avatar.TargetID, result.Avatar)
+	case AvatarTargetGroup:
+		err = models.UpdateGroupAvatar(avatar.TargetID, result.Avatar)
+	default:
+		err = fmt.Errorf("未知的头像类型: %s", avatar.Target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,465 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// 注册GIF解码器，动图只处理第一帧
+	_ "image/gif"
+)
+
+// 图片编码质量
+const (
+	thumbnailQuality = 80
+	originalQuality  = 90
+)
+
+// decodeImage 解码图片，解码前先检查尺寸，避免超大图片耗尽内存
+func decodeImage(data []byte, maxPixels int) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, "", fmt.Errorf("图片尺寸超出限制: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	return img, format, nil
+}
+
+// toRGBA 将图片转换为预乘alpha的RGBA格式
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// isOpaque 判断图片是否完全不透明
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// flatten 将透明部分合成到白色背景上，用于输出JPEG
+func flatten(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Over)
+	return rgba
+}
+
+// fitSize 按比例缩放到最长边不超过maxEdge
+func fitSize(width, height, maxEdge int) (int, int) {
+	if width >= height {
+		h := height * maxEdge / width
+		if h < 1 {
+			h = 1
+		}
+		return maxEdge, h
+	}
+	w := width * maxEdge / height
+	if w < 1 {
+		w = 1
+	}
+	return w, maxEdge
+}
+
+// cropSquare 从中间裁剪出正方形
+func cropSquare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	size := bounds.Dx()
+	if bounds.Dy() < size {
+		size = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-size)/2
+	y := bounds.Min.Y + (bounds.Dy()-size)/2
+
+	square := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(square, square.Rect, img, image.Pt(x, y), draw.Src)
+	return square
+}
+
+// resize 使用区域平均将图片缩小到指定尺寸，缩小时比最近邻插值更平滑
+func resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+	if srcW == width && srcH == height {
+		return src
+	}
+
+	// 先横向缩放，再纵向缩放
+	xWeights := boxWeights(srcW, width)
+	yWeights := boxWeights(srcH, height)
+
+	tmp := make([]float32, width*srcH*4)
+	for y := 0; y < srcH; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, weights := range xWeights {
+			var r, g, b, a float32
+			for _, w := range weights {
+				p := row[w.index*4:]
+				r += float32(p[0]) * w.weight
+				g += float32(p[1]) * w.weight
+				b += float32(p[2]) * w.weight
+				a += float32(p[3]) * w.weight
+			}
+			i := (y*width + x) * 4
+			tmp[i], tmp[i+1], tmp[i+2], tmp[i+3] = r, g, b, a
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range yWeights {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float32
+			for _, w := range weights {
+				i := (w.index*width + x) * 4
+				r += tmp[i] * w.weight
+				g += tmp[i+1] * w.weight
+				b += tmp[i+2] * w.weight
+				a += tmp[i+3] * w.weight
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			p[0], p[1], p[2], p[3] = clampUint8(r), clampUint8(g), clampUint8(b), clampUint8(a)
+		}
+	}
+	return dst
+}
+
+// sampleWeight 目标像素中一个源像素的权重
+type sampleWeight struct {
+	index  int
+	weight float32
+}
+
+// boxWeights 计算每个目标像素覆盖的源像素及其覆盖比例
+func boxWeights(srcSize, dstSize int) [][]sampleWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	weights := make([][]sampleWeight, dstSize)
+	for i := range weights {
+		start := float64(i) * scale
+		end := start + scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			// 源像素j覆盖[j, j+1)，取与[start, end)的交集
+			lo, hi := float64(j), float64(j+1)
+			if lo < start {
+				lo = start
+			}
+			if hi > end {
+				hi = end
+			}
+			if hi > lo {
+				weights[i] = append(weights[i], sampleWeight{index: j, weight: float32((hi - lo) / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+// clampUint8 四舍五入并限制到0~255
+func clampUint8(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// encodeThumbnail 编码缩略图，不透明的图片使用JPEG，否则使用PNG保留透明度
+func encodeThumbnail(img image.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if isOpaque(img) {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// dominantColor 计算图片的平均颜色，透明部分按白色计算
+func dominantColor(img *image.RGBA) string {
+	var r, g, b, n uint64
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			p := row[x*4:]
+			white := uint64(255 - p[3])
+			r += uint64(p[0]) + white
+			g += uint64(p[1]) + white
+			b += uint64(p[2]) + white
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r/n, g/n, b/n)
+}
+
+// jpegOrientation 读取JPEG中EXIF的方向标记，没有时返回1
+func jpegOrientation(data []byte) int {
+	segments, _ := jpegSegments(data)
+	for _, segment := range segments {
+		if segment.marker != 0xe1 || !bytes.HasPrefix(segment.payload, []byte("Exif\x00\x00")) {
+			continue
+		}
+		if orientation := tiffOrientation(segment.payload[6:]); orientation != 0 {
+			return orientation
+		}
+	}
+	return 1
+}
+
+// tiffOrientation 从EXIF的TIFF结构中读取第一个IFD的方向标记(0x0112)
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orient 按EXIF方向标记旋转或翻转图片，使其按正常方向显示
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = w-1-x, y
+			case 3: // 旋转180度
+				sx, sy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				sx, sy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				sx, sy = y, x
+			case 6: // 顺时针旋转90度
+				sx, sy = y, h-1-x
+			case 7: // 沿副对角线翻转
+				sx, sy = w-1-y, h-1-x
+			case 8: // 逆时针旋转90度
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+// jpegSegment JPEG中扫描数据之前的一个段
+type jpegSegment struct {
+	marker  byte
+	start   int // 段在文件中的起始位置（含标记之前的0xFF填充字节）
+	end     int
+	payload []byte
+}
+
+// jpegSegments 解析JPEG扫描数据之前的所有段。标记之前可以有任意个0xFF填充字节。
+// complete表示是否解析到了扫描数据开始(SOS)，为false时文件格式错误，返回已解析的部分
+func jpegSegments(data []byte) (segments []jpegSegment, complete bool) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, false
+	}
+
+	pos := 2
+	for pos+2 <= len(data) && data[pos] == 0xff {
+		start := pos
+		for pos+1 < len(data) && data[pos+1] == 0xff {
+			pos++
+		}
+		if pos+2 > len(data) {
+			break
+		}
+		marker := data[pos+1]
+		// 扫描数据开始，之后不再有元数据段
+		if marker == 0xda {
+			return segments, true
+		}
+		// TEM和RST没有长度字段
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			pos += 2
+			segments = append(segments, jpegSegment{marker: marker, start: start, end: pos})
+			continue
+		}
+		if pos+4 > len(data) {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segments = append(segments, jpegSegment{
+			marker:  marker,
+			start:   start,
+			end:     end,
+			payload: data[pos+4 : end],
+		})
+		pos = end
+	}
+	return segments, false
+}
+
+// stripJPEGMetadata 删除JPEG中的EXIF、XMP、IPTC和注释段，不重新编码图像数据。
+// 保留JFIF、ICC颜色配置和Adobe段，它们影响图片的显示。
+// ok为false表示无法完整解析到扫描数据，元数据可能没有去除干净，调用方需要重新编码图片
+func stripJPEGMetadata(data []byte) (stripped []byte, ok bool) {
+	segments, complete := jpegSegments(data)
+	if !complete {
+		return data, false
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	pos := 2
+	removed := false
+	for _, segment := range segments {
+		out.Write(data[pos:segment.start])
+		pos = segment.end
+		switch segment.marker {
+		case 0xe1, 0xed, 0xfe: // APP1(EXIF/XMP)、APP13(IPTC)、COM
+			removed = true
+			continue
+		}
+		out.Write(data[segment.start:segment.end])
+	}
+	if !removed {
+		return data, true
+	}
+	out.Write(data[pos:])
+	return out.Bytes(), true
+}
+
+// pngSignature PNG文件头
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNGMetadata 删除PNG中的EXIF、文本和时间块，不重新编码图像数据。
+// ok为false表示块结构无法完整解析，调用方需要重新编码图片
+func stripPNGMetadata(data []byte) (stripped []byte, ok bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data, false
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	pos := len(pngSignature)
+	removed := false
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return data, false
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return data, false
+		}
+		switch string(data[pos+4 : pos+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+			removed = true
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	if !removed {
+		return data, true
+	}
+	return out.Bytes(), true
+}
+
+// sanitizeOriginal 去除原图中的元数据。带有方向标记的JPEG需要按方向重新编码，
+// 否则去掉EXIF后会显示为旋转前的样子；无法完整解析文件结构时同样重新编码，
+// 保证不会把带有元数据的原图原样提供下载。返回nil表示原图无需修改
+func sanitizeOriginal(data []byte, img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		orientation := jpegOrientation(data)
+		stripped, ok := stripJPEGMetadata(data)
+		if orientation == 1 && ok {
+			if len(stripped) != len(data) {
+				return stripped, nil
+			}
+			return nil, nil
+		}
+		if err := jpeg.Encode(&buf, orient(img, orientation), &jpeg.Options{Quality: originalQuality}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "png":
+		stripped, ok := stripPNGMetadata(data)
+		if ok {
+			if len(stripped) != len(data) {
+				return stripped, nil
+			}
+			return nil, nil
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,332 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testTIFF 构造只有一个方向标记的TIFF结构
+func testTIFF(order binary.ByteOrder, orientation uint16) []byte {
+	var b bytes.Buffer
+	if order == binary.LittleEndian {
+		b.WriteString("II")
+	} else {
+		b.WriteString("MM")
+	}
+	binary.Write(&b, order, uint16(42))
+	binary.Write(&b, order, uint32(8))
+	binary.Write(&b, order, uint16(1))
+	binary.Write(&b, order, uint16(0x0112)) // 方向
+	binary.Write(&b, order, uint16(3))      // SHORT
+	binary.Write(&b, order, uint32(1))
+	binary.Write(&b, order, orientation)
+	binary.Write(&b, order, uint16(0))
+	binary.Write(&b, order, uint32(0))
+	return b.Bytes()
+}
+
+// testSegment 构造一个JPEG段
+func testSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// testJPEG 编码一张JPEG，并在SOI之后插入extra
+func testJPEG(t *testing.T, extra ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	for _, e := range extra {
+		out = append(out, e...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestTiffOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", testTIFF(binary.LittleEndian, 6), 6},
+		{"big endian", testTIFF(binary.BigEndian, 8), 8},
+		{"normal", testTIFF(binary.BigEndian, 1), 1},
+		{"out of range", testTIFF(binary.LittleEndian, 9), 0},
+		{"bad byte order", append([]byte("XX"), testTIFF(binary.LittleEndian, 6)[2:]...), 0},
+		{"too short", []byte("II*\x00"), 0},
+		{"truncated entry", testTIFF(binary.LittleEndian, 6)[:14], 0},
+		{"offset out of range", []byte("II*\x00\xff\xff\x00\x00"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tiffOrientation(tt.tiff); got != tt.want {
+				t.Errorf("tiffOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJPEGSegments(t *testing.T) {
+	exif := testSegment(0xe1, append([]byte("Exif\x00\x00"), testTIFF(binary.BigEndian, 6)...))
+
+	tests := []struct {
+		name         string
+		data         []byte
+		wantMarkers  []byte
+		wantComplete bool
+	}{
+		{"plain", testJPEG(t), []byte{0xdb, 0xc0, 0xc4}, true},
+		{"exif", testJPEG(t, exif), []byte{0xe1, 0xdb, 0xc0, 0xc4}, true},
+		{"fill bytes before marker", testJPEG(t, []byte{0xff, 0xff}, exif), []byte{0xe1, 0xdb, 0xc0, 0xc4}, true},
+		{"not jpeg", []byte("GIF89a"), nil, false},
+		{"truncated", testJPEG(t, exif)[:len(exif)+8], []byte{0xe1}, false},
+		{"bad length", []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments, complete := jpegSegments(tt.data)
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+			var markers []byte
+			for _, segment := range segments {
+				markers = append(markers, segment.marker)
+			}
+			if !bytes.Equal(uniqueMarkers(markers), tt.wantMarkers) {
+				t.Errorf("markers = %x, want %x", markers, tt.wantMarkers)
+			}
+		})
+	}
+}
+
+// uniqueMarkers 去掉相邻重复的标记，编码器可能写出多个DQT/DHT段
+func uniqueMarkers(markers []byte) []byte {
+	var out []byte
+	for i, m := range markers {
+		if i == 0 || markers[i-1] != m {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	secret := []byte("Exif\x00\x00SECRET")
+	exif := testSegment(0xe1, secret)
+	comment := testSegment(0xfe, []byte("SECRET comment"))
+	icc := testSegment(0xe2, []byte("ICC_PROFILE\x00"))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantOK  bool
+		changed bool
+	}{
+		{"no metadata", testJPEG(t), true, false},
+		{"exif and comment", testJPEG(t, exif, comment), true, true},
+		{"fill bytes before exif", testJPEG(t, []byte{0xff, 0xff, 0xff}, exif), true, true},
+		{"icc kept", testJPEG(t, icc), true, false},
+		{"truncated before scan", testJPEG(t, exif)[:40], false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped, ok := stripJPEGMetadata(tt.data)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if changed := !bytes.Equal(stripped, tt.data); changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if bytes.Contains(stripped, []byte("SECRET")) {
+				t.Error("metadata was not stripped")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+				t.Errorf("stripped image does not decode: %v", err)
+			}
+		})
+	}
+}
+
+// testPNG 编码一张PNG，并在IHDR之后插入extra块
+func testPNG(t *testing.T, extra ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	ihdrEnd := len(pngSignature) + 12 + 13
+	out := append([]byte{}, data[:ihdrEnd]...)
+	for _, e := range extra {
+		out = append(out, e...)
+	}
+	return append(out, data[ihdrEnd:]...)
+}
+
+// testChunk 构造一个PNG块，CRC不做校验，填0即可
+func testChunk(kind string, payload []byte) []byte {
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, payload...)
+	return append(chunk, 0, 0, 0, 0)
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantOK  bool
+		changed bool
+	}{
+		{"no metadata", testPNG(t), true, false},
+		{"text and exif", testPNG(t, testChunk("tEXt", []byte("GPS\x00SECRET")), testChunk("eXIf", []byte("SECRET"))), true, true},
+		{"time", testPNG(t, testChunk("tIME", make([]byte, 7))), true, true},
+		{"other chunk kept", testPNG(t, testChunk("gAMA", make([]byte, 4))), true, false},
+		{"not png", []byte("GIF89a"), false, false},
+		{"truncated chunk", testPNG(t)[:40], false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped, ok := stripPNGMetadata(tt.data)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if changed := !bytes.Equal(stripped, tt.data); changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if bytes.Contains(stripped, []byte("SECRET")) {
+				t.Error("metadata was not stripped")
+			}
+		})
+	}
+}
+
+func TestSanitizeOriginal(t *testing.T) {
+	secret := testSegment(0xe1, []byte("Exif\x00\x00SECRET"))
+	rotated := testSegment(0xe1, append([]byte("Exif\x00\x00"), testTIFF(binary.BigEndian, 6)...))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantNil  bool
+		wantSize image.Point
+	}{
+		{"clean image unchanged", testJPEG(t), true, image.Point{}},
+		{"fill bytes before exif", testJPEG(t, []byte{0xff}, secret), false, image.Pt(4, 2)},
+		{"orientation applied", testJPEG(t, rotated), false, image.Pt(2, 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := image.Decode(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := sanitizeOriginal(tt.data, img, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if out != nil {
+					t.Fatal("clean image should not be rewritten")
+				}
+				return
+			}
+			if bytes.Contains(out, []byte("SECRET")) {
+				t.Error("metadata was not stripped")
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := image.Pt(cfg.Width, cfg.Height); got != tt.wantSize {
+				t.Errorf("size = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestEncodeBlurHash(t *testing.T) {
+	solid := func(w, h int, c color.RGBA) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		return img
+	}
+	// 黑色图片的线性颜色值为0，交流分量全部为零，每个都编码为"fQ"
+	flat := strings.Repeat("fQ", blurHashComponentsLong*blurHashComponentsShort-1)
+	hashLength := 6 + 2*(blurHashComponentsLong*blurHashComponentsShort-1)
+
+	tests := []struct {
+		name   string
+		img    *image.RGBA
+		prefix string // 分量数、最大交流分量之后的直流分量，即平均颜色
+		want   string // 不为空时比较完整的结果
+	}{
+		{"black landscape", solid(8, 6, color.RGBA{0, 0, 0, 255}), "L", "L00000" + flat},
+		{"portrait swaps components", solid(6, 8, color.RGBA{0, 0, 0, 255}), "T", "T00000" + flat},
+		{"white", solid(8, 6, color.RGBA{255, 255, 255, 255}), "L", ""},
+		{"transparent as white", solid(8, 6, color.RGBA{}), "L", ""},
+		{"red", solid(4, 4, color.RGBA{255, 0, 0, 255}), "L", ""},
+	}
+	dc := map[string]string{
+		"white":                encodeBase83(0xffffff, 4),
+		"transparent as white": encodeBase83(0xffffff, 4),
+		"red":                  encodeBase83(0xff0000, 4),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeBlurHash(tt.img)
+			if tt.want != "" && got != tt.want {
+				t.Fatalf("encodeBlurHash() = %q, want %q", got, tt.want)
+			}
+			if len(got) != hashLength || got[:1] != tt.prefix {
+				t.Fatalf("encodeBlurHash() = %q, want %d characters starting with %q", got, hashLength, tt.prefix)
+			}
+			if want, ok := dc[tt.name]; ok && got[2:6] != want {
+				t.Errorf("dc = %q, want %q", got[2:6], want)
+			}
+		})
+	}
+
+	if got := encodeBlurHash(image.NewRGBA(image.Rect(0, 0, 0, 0))); got != "" {
+		t.Errorf("empty image hash = %q, want empty", got)
+	}
+
+	// 有颜色变化的图片交流分量不为零
+	gradient := image.NewRGBA(image.Rect(0, 0, 16, 12))
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			gradient.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 20), 128, 255})
+		}
+	}
+	hash := encodeBlurHash(gradient)
+	if len(hash) != hashLength {
+		t.Fatalf("hash %q has length %d", hash, len(hash))
+	}
+	if hash[1] == '0' || strings.HasSuffix(hash, flat) {
+		t.Errorf("gradient hash %q has no AC components", hash)
+	}
+}
@@ -0,0 +1,168 @@
+package media
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// job 图片处理任务，attachmentID和avatar二选一
+type job struct {
+	attachmentID uint
+	avatar       *AvatarJob
+}
+
+// pendingSweepInterval 重新排队待处理附件的间隔，队列已满时没有排上的附件由此补上
+const pendingSweepInterval = time.Minute
+
+// pipeline 固定数量的worker从队列中取任务处理，限制同时解码的图片数量
+type pipeline struct {
+	jobs chan job
+
+	// queued 已经在队列中或正在处理的附件，避免定期排队时重复处理
+	queuedMu sync.Mutex
+	queued   map[uint]bool
+
+	mu              sync.RWMutex
+	attachmentHooks []func(*models.Attachment)
+	avatarHooks     []func(AvatarResult)
+}
+
+// defaultPipeline 全局图片处理管道
+var defaultPipeline = &pipeline{queued: make(map[uint]bool)}
+
+// InitPipeline 启动图片处理worker，并定期将待处理的附件重新排队，
+// 包括上次运行未处理完的附件和队列已满时没有排上的附件
+func InitPipeline() {
+	cfg := config.AppConfig.Media
+	defaultPipeline.jobs = make(chan job, cfg.QueueSize)
+	for i := 0; i < cfg.Workers; i++ {
+		go defaultPipeline.work()
+	}
+	log.Printf("图片处理管道已启动: %d个worker", cfg.Workers)
+
+	go func() {
+		defaultPipeline.sweepPending()
+		ticker := time.NewTicker(pendingSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			defaultPipeline.sweepPending()
+		}
+	}()
+}
+
+// OnAttachmentProcessed 添加附件处理完成（包括失败）的回调，回调在worker中执行
+func OnAttachmentProcessed(hook func(*models.Attachment)) {
+	defaultPipeline.mu.Lock()
+	defer defaultPipeline.mu.Unlock()
+	defaultPipeline.attachmentHooks = append(defaultPipeline.attachmentHooks, hook)
+}
+
+// OnAvatarProcessed 添加头像处理完成的回调，回调在worker中执行
+func OnAvatarProcessed(hook func(AvatarResult)) {
+	defaultPipeline.mu.Lock()
+	defer defaultPipeline.mu.Unlock()
+	defaultPipeline.avatarHooks = append(defaultPipeline.avatarHooks, hook)
+}
+
+// CanProcess 判断是否能为该类型的图片生成缩略图
+func CanProcess(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// EnqueueAttachment 将附件加入处理队列。队列已满时直接放弃，附件保持pending状态，由定期排队补上
+func EnqueueAttachment(attachmentID uint) {
+	defaultPipeline.enqueueAttachment(attachmentID)
+}
+
+// enqueueAttachment 不阻塞地将附件加入队列，已经在队列中或队列已满时返回false
+func (p *pipeline) enqueueAttachment(attachmentID uint) bool {
+	p.queuedMu.Lock()
+	defer p.queuedMu.Unlock()
+	if p.queued[attachmentID] {
+		return false
+	}
+	select {
+	case p.jobs <- job{attachmentID: attachmentID}:
+		p.queued[attachmentID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// sweepPending 将仍为pending状态的附件重新排队，队列满时停止，剩下的等下一次
+func (p *pipeline) sweepPending() {
+	ids, err := models.GetPendingAttachmentIDs()
+	if err != nil {
+		log.Printf("获取待处理附件失败: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if !p.enqueueAttachment(id) && len(p.jobs) == cap(p.jobs) {
+			return
+		}
+	}
+}
+
+// EnqueueAvatar 将头像加入处理队列，队列已满时返回false
+func EnqueueAvatar(avatar *AvatarJob) bool {
+	select {
+	case defaultPipeline.jobs <- job{avatar: avatar}:
+		return true
+	default:
+		return false
+	}
+}
+
+// work 循环处理队列中的任务
+func (p *pipeline) work() {
+	for j := range p.jobs {
+		if j.avatar != nil {
+			p.runAvatar(j.avatar)
+		} else {
+			p.runAttachment(j.attachmentID)
+			p.queuedMu.Lock()
+			delete(p.queued, j.attachmentID)
+			p.queuedMu.Unlock()
+		}
+	}
+}
+
+// runAttachment 处理附件并执行回调
+func (p *pipeline) runAttachment(attachmentID uint) {
+	attachment := processAttachment(attachmentID)
+	if attachment == nil {
+		return
+	}
+
+	p.mu.RLock()
+	hooks := p.attachmentHooks
+	p.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(attachment)
+	}
+}
+
+// runAvatar 处理头像并执行回调
+func (p *pipeline) runAvatar(avatar *AvatarJob) {
+	result, err := processAvatar(avatar)
+	if err != nil {
+		log.Printf("处理头像失败: %s %d: %v", avatar.Target, avatar.TargetID, err)
+		return
+	}
+
+	p.mu.RLock()
+	hooks := p.avatarHooks
+	p.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(*result)
+	}
+}
@@ -0,0 +1,34 @@
+package media
+
+import "testing"
+
+func TestEnqueueAttachmentDoesNotBlock(t *testing.T) {
+	p := &pipeline{jobs: make(chan job, 2), queued: make(map[uint]bool)}
+
+	steps := []struct {
+		id   uint
+		want bool
+	}{
+		{1, true},
+		{1, false}, // 已经在队列中
+		{2, true},
+		{3, false}, // 队列已满，直接放弃
+	}
+	for _, step := range steps {
+		if got := p.enqueueAttachment(step.id); got != step.want {
+			t.Errorf("enqueueAttachment(%d) = %v, want %v", step.id, got, step.want)
+		}
+	}
+	if p.queued[3] {
+		t.Error("dropped attachment should not be marked as queued")
+	}
+
+	// 处理完成后可以再次排队
+	<-p.jobs
+	p.queuedMu.Lock()
+	delete(p.queued, 1)
+	p.queuedMu.Unlock()
+	if !p.enqueueAttachment(1) {
+		t.Error("attachment should be queued again after it was processed")
+	}
+}
@@ -0,0 +1,249 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 附件类型常量
+const (
+	AttachmentKindImage = "image" // 图片
+	AttachmentKindVideo = "video" // 视频
+	AttachmentKindAudio = "audio" // 音频
+	AttachmentKindFile  = "file"  // 其他文件
+)
+
+// 图片处理状态常量
+const (
+	MediaStatusPending = "pending" // 等待生成缩略图
+	MediaStatusReady   = "ready"   // 处理完成
+	MediaStatusFailed  = "failed"  // 无法解码等原因处理失败
+)
+
+// ErrAttachmentUnavailable 附件不存在、不属于发送者或已被其他消息使用
+var ErrAttachmentUnavailable = errors.New("附件不可用")
+
+// Attachment 上传的文件，内容相同的文件在存储中只保存一份
+type Attachment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UploaderID  uint      `gorm:"not null;index" json:"uploaderId"`
+	MessageID   *uint     `gorm:"index" json:"messageId,omitempty"` // 发送后关联的消息，未发送时为空
+	Kind        string    `gorm:"size:20;not null" json:"kind"`     // image, video, audio, file
+	FileName    string    `gorm:"size:255" json:"fileName"`
+	ContentType string    `gorm:"size:100;not null" json:"contentType"`
+	Size        int64     `gorm:"not null" json:"size"`
+	SHA256      string    `gorm:"size:64;not null;index" json:"sha256"`
+	StorageKey  string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	// 以下字段由图片处理任务填充
+	MediaStatus   string                `gorm:"size:20" json:"mediaStatus,omitempty"` // 非图片附件为空
+	Width         int                   `json:"width,omitempty"`
+	Height        int                   `json:"height,omitempty"`
+	BlurHash      string                `gorm:"size:64" json:"blurHash,omitempty"`     // 加载原图前显示的模糊占位图
+	DominantColor string                `gorm:"size:7" json:"dominantColor,omitempty"` // 主色调，如 #a0b1c2
+	Thumbnails    []AttachmentThumbnail `gorm:"type:text;serializer:json" json:"thumbnails,omitempty"`
+}
+
+// AttachmentThumbnail 图片附件的缩略图
+type AttachmentThumbnail struct {
+	Size        int    `json:"size"` // 缩略图规格，即最长边的上限
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"contentType"`
+}
+
+// UploadSession 分片上传会话，分片按顺序追加到暂存文件
+type UploadSession struct {
+	ID         string    `gorm:"primaryKey;size:32" json:"id"`
+	UploaderID uint      `gorm:"not null;index" json:"uploaderId"`
+	FileName   string    `gorm:"size:255" json:"fileName"`
+	Size       int64     `gorm:"not null" json:"size"`   // 文件总大小
+	Offset     int64     `gorm:"not null" json:"offset"` // 已接收的字节数
+	ExpiresAt  time.Time `gorm:"index" json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// AttachmentKindOf 根据MIME类型判断附件类型
+func AttachmentKindOf(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return AttachmentKindImage
+	case strings.HasPrefix(contentType, "video/"):
+		return AttachmentKindVideo
+	case strings.HasPrefix(contentType, "audio/"):
+		return AttachmentKindAudio
+	default:
+		return AttachmentKindFile
+	}
+}
+
+// BlobStorageKey 按内容哈希生成存储key，相同内容的文件共用一个对象
+func BlobStorageKey(sha256 string) string {
+	return "blobs/" + sha256[:2] + "/" + sha256
+}
+
+// ThumbnailStorageKey 缩略图的存储key，内容相同的图片共用缩略图
+func ThumbnailStorageKey(sha256 string, size int, contentType string) string {
+	ext := "jpg"
+	if contentType == "image/png" {
+		ext = "png"
+	}
+	return fmt.Sprintf("derived/%s/%s/thumb_%d.%s", sha256[:2], sha256, size, ext)
+}
+
+// SanitizedStorageKey 去除元数据后的原图的存储key
+func SanitizedStorageKey(sha256 string) string {
+	return fmt.Sprintf("derived/%s/%s/original", sha256[:2], sha256)
+}
+
+// Thumbnail 返回不小于size的最小缩略图，没有时返回最大的缩略图
+func (a *Attachment) Thumbnail(size int) *AttachmentThumbnail {
+	var best *AttachmentThumbnail
+	for i := range a.Thumbnails {
+		thumbnail := &a.Thumbnails[i]
+		switch {
+		case best == nil:
+			best = thumbnail
+		case best.Size < size && thumbnail.Size > best.Size:
+			best = thumbnail
+		case thumbnail.Size >= size && thumbnail.Size < best.Size:
+			best = thumbnail
+		}
+	}
+	return best
+}
+
+// CreateAttachment 保存附件记录
+func CreateAttachment(attachment *Attachment) error {
+	return DB.Create(attachment).Error
+}
+
+// GetAttachmentByID 根据ID获取附件
+func GetAttachmentByID(id uint) (*Attachment, error) {
+	var attachment Attachment
+	result := DB.First(&attachment, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &attachment, nil
+}
+
+// UpdateAttachmentMedia 保存图片处理的结果
+func UpdateAttachmentMedia(attachment *Attachment) error {
+	return DB.Model(attachment).Select(
+		"storage_key", "size", "media_status", "width", "height", "blur_hash", "dominant_color", "thumbnails",
+	).Updates(attachment).Error
+}
+
+// GetProcessedAttachment 查找内容相同且已处理完成的附件，用于复用处理结果
+func GetProcessedAttachment(sha256 string) (*Attachment, error) {
+	var attachment Attachment
+	result := DB.Where("sha256 = ? AND media_status = ?", sha256, MediaStatusReady).First(&attachment)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &attachment, nil
+}
+
+// GetPendingAttachmentIDs 获取等待图片处理的附件ID，用于服务重启后重新排队
+func GetPendingAttachmentIDs() ([]uint, error) {
+	var ids []uint
+	err := DB.Model(&Attachment{}).Where("media_status = ?", MediaStatusPending).Order("id ASC").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// attachToMessage 在事务中将发送者尚未使用的附件关联到消息
+func attachToMessage(tx *gorm.DB, message *Message, attachmentIDs []uint) error {
+	result := tx.Model(&Attachment{}).
+		Where("id IN ? AND uploader_id = ? AND message_id IS NULL", attachmentIDs, message.SenderID).
+		Update("message_id", message.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(attachmentIDs)) {
+		return ErrAttachmentUnavailable
+	}
+
+	return tx.Where("id IN ?", attachmentIDs).Order("id ASC").Find(&message.Attachments).Error
+}
+
+// LoadAttachments 为消息批量填充附件
+func LoadAttachments(messages []*Message) error {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var attachments []*Attachment
+	if err := DB.Where("message_id IN ?", ids).Order("id ASC").Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	byMessage := make(map[uint][]*Attachment)
+	for _, attachment := range attachments {
+		byMessage[*attachment.MessageID] = append(byMessage[*attachment.MessageID], attachment)
+	}
+	for _, message := range messages {
+		// 已撤回消息的附件不再返回
+		if message.Recalled {
+			message.Attachments = nil
+			continue
+		}
+		message.Attachments = byMessage[message.ID]
+	}
+	return nil
+}
+
+// CreateUploadSession 创建分片上传会话
+func CreateUploadSession(session *UploadSession) error {
+	return DB.Create(session).Error
+}
+
+// GetUploadSession 获取上传者未过期的分片上传会话
+func GetUploadSession(id string, uploaderID uint) (*UploadSession, error) {
+	var session UploadSession
+	result := DB.Where("id = ? AND uploader_id = ? AND expires_at > ?", id, uploaderID, time.Now()).First(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// AdvanceUploadSession 更新分片上传会话已接收的字节数，只有offset与当前值一致时才更新
+func AdvanceUploadSession(session *UploadSession, offset int64) (bool, error) {
+	result := DB.Model(&UploadSession{}).
+		Where("id = ? AND `offset` = ?", session.ID, session.Offset).
+		Update("offset", offset)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	session.Offset = offset
+	return true, nil
+}
+
+// DeleteUploadSession 删除分片上传会话
+func DeleteUploadSession(id string) error {
+	return DB.Where("id = ?", id).Delete(&UploadSession{}).Error
+}
+
+// GetExpiredUploadSessions 获取已过期的分片上传会话
+func GetExpiredUploadSessions(limit int) ([]*UploadSession, error) {
+	var sessions []*UploadSession
+	result := DB.Where("expires_at <= ?", time.Now()).Limit(limit).Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserBlock 用户屏蔽关系，被屏蔽的用户不会收到任何提示
+type UserBlock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_user_block" json:"userId"`          // 屏蔽者
+	BlockedID uint      `gorm:"not null;uniqueIndex:idx_user_block;index" json:"blockedId"` // 被屏蔽的用户
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BlockUser 屏蔽用户并返回屏蔽关系，已经屏蔽时返回原有的记录。同时撤销自己发给对方、尚未处理的好友请求
+func BlockUser(userID, blockedID uint) (*UserBlock, error) {
+	var block UserBlock
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserBlock{UserID: userID, BlockedID: blockedID}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND blocked_id = ?", userID, blockedID).First(&block).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND friend_id = ? AND status = ?", userID, blockedID, FriendshipPending).
+			Delete(&Friendship{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// UnblockUser 取消屏蔽
+func UnblockUser(userID, blockedID uint) error {
+	result := DB.Where("user_id = ? AND blocked_id = ?", userID, blockedID).Delete(&UserBlock{})
+	return result.Error
+}
+
+// GetBlockedUsers 获取用户屏蔽的全部用户，按屏蔽时间倒序排列
+func GetBlockedUsers(userID uint) ([]*UserBlock, error) {
+	var blocks []*UserBlock
+	result := DB.Where("user_id = ?", userID).Order("id DESC").Find(&blocks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return blocks, nil
+}
+
+// IsBlocked userID是否屏蔽了blockedID
+func IsBlocked(userID, blockedID uint) (bool, error) {
+	var count int64
+	err := DB.Model(&UserBlock{}).
+		Where("user_id = ? AND blocked_id = ?", userID, blockedID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetBlockers 获取屏蔽了该用户的全部屏蔽关系
+func GetBlockers(userID uint) ([]*UserBlock, error) {
+	var blocks []*UserBlock
+	result := DB.Where("blocked_id = ?", userID).Find(&blocks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return blocks, nil
+}
+
+// GetAllBlocks 获取全部屏蔽关系，启动时加载到WebSocket Hub
+func GetAllBlocks() ([]*UserBlock, error) {
+	var blocks []*UserBlock
+	result := DB.Find(&blocks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return blocks, nil
+}
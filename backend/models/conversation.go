@@ -0,0 +1,178 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 会话变更类型常量
+const (
+	ChangeKindMessage  = "message"  // 新消息
+	ChangeKindEdit     = "edit"     // 消息被编辑
+	ChangeKindRecall   = "recall"   // 消息被撤回
+	ChangeKindThread   = "thread"   // 话题根消息的回复数发生变化
+	ChangeKindReaction = "reaction" // 消息的表情回应发生变化
+	ChangeKindHidden   = "hidden"   // 消息被用户"仅对自己删除"，只同步给该用户
+)
+
+// Conversation 会话，负责分配会话内单调递增的序列号，并记录最后一条消息
+type Conversation struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	ConversationKey string     `gorm:"size:50;uniqueIndex;not null" json:"conversationKey"`
+	Type            string     `gorm:"size:20;not null" json:"type"` // private, group
+	LastSeq         uint64     `gorm:"not null;default:0" json:"lastSeq"`
+	LastMessageID   uint       `gorm:"not null;default:0" json:"lastMessageId"` // 最后一条主时间线消息
+	LastMessageAt   *time.Time `json:"lastMessageAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// ConversationChange 会话的变更日志，新消息、编辑、删除等每次变更占用一个序列号
+type ConversationChange struct {
+	ID              uint      `gorm:"primaryKey" json:"-"`
+	ConversationKey string    `gorm:"size:50;not null;uniqueIndex:idx_change_conversation_seq" json:"conversationKey"`
+	Seq             uint64    `gorm:"not null;uniqueIndex:idx_change_conversation_seq" json:"seq"`
+	Kind            string    `gorm:"size:20;not null" json:"kind"`
+	MessageID       uint      `gorm:"not null;index" json:"messageId"`
+	UserID          uint      `gorm:"not null;default:0" json:"-"` // 只对该用户可见的变更，0表示对会话的全部成员可见
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// PrivateConversationKey 私聊会话标识，与双方顺序无关
+func PrivateConversationKey(userID, otherID uint) string {
+	if userID > otherID {
+		userID, otherID = otherID, userID
+	}
+	return fmt.Sprintf("private:%d:%d", userID, otherID)
+}
+
+// GroupConversationKey 群聊会话标识
+func GroupConversationKey(groupID uint) string {
+	return fmt.Sprintf("group:%d", groupID)
+}
+
+// nextSeq 在事务中为会话分配下一个序列号，会话行的行锁保证同一会话内序列号严格递增
+func nextSeq(tx *gorm.DB, conversationKey, conversationType string) (uint64, error) {
+	// 会话不存在时先创建
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Conversation{
+		ConversationKey: conversationKey,
+		Type:            conversationType,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Model(&Conversation{}).
+		Where("conversation_key = ?", conversationKey).
+		Update("last_seq", gorm.Expr("last_seq + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var conversation Conversation
+	err = tx.Where("conversation_key = ?", conversationKey).First(&conversation).Error
+	if err != nil {
+		return 0, err
+	}
+	return conversation.LastSeq, nil
+}
+
+// appendChange 在事务中为会话追加一条变更记录，返回分配的序列号
+func appendChange(tx *gorm.DB, conversationKey, conversationType, kind string, messageID uint) (uint64, error) {
+	return appendUserChange(tx, conversationKey, conversationType, kind, messageID, 0)
+}
+
+// appendUserChange 在事务中追加一条只对userID可见的会话变更，userID为0时对全部成员可见。
+// 其他成员同步时会跳过该序列号
+func appendUserChange(tx *gorm.DB, conversationKey, conversationType, kind string, messageID, userID uint) (uint64, error) {
+	seq, err := nextSeq(tx, conversationKey, conversationType)
+	if err != nil {
+		return 0, err
+	}
+
+	change := &ConversationChange{
+		ConversationKey: conversationKey,
+		Seq:             seq,
+		Kind:            kind,
+		MessageID:       messageID,
+		UserID:          userID,
+	}
+	if err := tx.Create(change).Error; err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// GetChangesSince 获取会话中序列号大于since、对viewerID可见的变更，按序列号升序
+func GetChangesSince(conversationKey string, viewerID uint, since uint64, limit int) ([]*ConversationChange, error) {
+	var changes []*ConversationChange
+	result := DB.Where("conversation_key = ? AND seq > ?", conversationKey, since).
+		Where("user_id IN ?", []uint{0, viewerID}).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&changes)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return changes, nil
+}
+
+// GetMessagesByIDs 根据ID批量获取消息
+func GetMessagesByIDs(ids []uint) (map[uint]*Message, error) {
+	messages := make(map[uint]*Message, len(ids))
+	if len(ids) == 0 {
+		return messages, nil
+	}
+
+	var list []*Message
+	if err := DB.Where("id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, message := range list {
+		messages[message.ID] = message
+	}
+	return messages, nil
+}
+
+// backfillMessageSeq 为迁移前保存的、还没有序列号的消息补齐会话标识和序列号
+func backfillMessageSeq() error {
+	for {
+		var messages []*Message
+		err := DB.Where("conversation_key = ? OR conversation_key IS NULL", "").
+			Order("id ASC").
+			Limit(500).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			for _, message := range messages {
+				key := message.conversationKey()
+				seq, err := appendChange(tx, key, message.Type, ChangeKindMessage, message.ID)
+				if err != nil {
+					return err
+				}
+				err = tx.Model(message).Updates(map[string]interface{}{
+					"conversation_key": key,
+					"seq":              seq,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
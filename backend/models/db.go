@@ -58,11 +58,69 @@ func InitDB() {
 
 // autoMigrate 自动创建或更新数据库表结构
 func autoMigrate() error {
-	return DB.AutoMigrate(
+	err := DB.AutoMigrate(
 		&User{},
 		&Friendship{},
 		&Group{},
 		&GroupMember{},
 		&Message{},
+		&MessageRevision{},
+		&MessageHidden{},
+		&MessageReaction{},
+		&MessageMention{},
+		&ReadCursor{},
+		&MessageDelivery{},
+		&Conversation{},
+		&ConversationChange{},
+		&UserConversation{},
+		&Attachment{},
+		&UploadSession{},
+		&UserBlock{},
+		&FriendSetting{},
+		&FriendSuggestionDismissal{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// 为旧消息补齐会话序列号
+	if err := backfillMessageSeq(); err != nil {
+		return err
+	}
+
+	// 为旧会话补齐最后一条消息
+	if err := backfillLastMessages(); err != nil {
+		return err
+	}
+
+	return createIndexes()
+}
+
+// compositeIndex 需要在迁移时创建的组合索引
+type compositeIndex struct {
+	table   string
+	name    string
+	columns string
+}
+
+// compositeIndexes 查询依赖的组合索引
+var compositeIndexes = []compositeIndex{
+	// 消息历史按会话和ID做游标分页
+	{table: "messages", name: "idx_messages_conversation_id", columns: "conversation_key, id"},
+	// 话题回复按根消息和ID做游标分页
+	{table: "messages", name: "idx_messages_thread_id", columns: "thread_root_id, id"},
+}
+
+// createIndexes 创建不存在的组合索引和用户搜索使用的全文索引
+func createIndexes() error {
+	for _, index := range compositeIndexes {
+		if DB.Migrator().HasIndex(index.table, index.name) {
+			continue
+		}
+		sql := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index.name, index.table, index.columns)
+		if err := DB.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return createUserFullTextIndex()
 }
\ No newline at end of file
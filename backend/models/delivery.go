@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 投递状态常量
+const (
+	DeliveryStatusQueued    = "queued"    // 已入队，等待客户端确认
+	DeliveryStatusDelivered = "delivered" // 客户端已确认收到
+	DeliveryStatusRead      = "read"      // 接收者已读
+)
+
+// MessageDelivery 消息对每个接收者的投递状态
+type MessageDelivery struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	MessageID   uint       `gorm:"not null;uniqueIndex:idx_delivery_message_user" json:"messageId"`
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_delivery_message_user;index:idx_delivery_user_status" json:"userId"`
+	Status      string     `gorm:"size:20;not null;default:'queued';index:idx_delivery_user_status" json:"status"` // queued, delivered, read
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+	ReadAt      *time.Time `json:"readAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// CreateDeliveries 为消息的每个接收者创建排队中的投递记录
+func CreateDeliveries(messageID uint, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	deliveries := make([]*MessageDelivery, 0, len(userIDs))
+	for _, userID := range userIDs {
+		deliveries = append(deliveries, &MessageDelivery{
+			MessageID: messageID,
+			UserID:    userID,
+			Status:    DeliveryStatusQueued,
+		})
+	}
+
+	result := DB.Create(&deliveries)
+	return result.Error
+}
+
+// GetQueuedMessages 获取用户尚未确认收到的消息，按发送先后排序
+func GetQueuedMessages(userID uint, limit int) ([]*Message, error) {
+	var messages []*Message
+	result := DB.Joins("JOIN message_deliveries ON message_deliveries.message_id = messages.id").
+		Where("message_deliveries.user_id = ? AND message_deliveries.status = ?", userID, DeliveryStatusQueued).
+		Where("messages.recalled = ?", false).
+		Order("messages.id ASC").
+		Limit(limit).
+		Find(&messages)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return messages, nil
+}
+
+// MarkDelivered 将用户确认收到的消息标记为已送达，返回本次状态发生变化的消息
+func MarkDelivered(userID uint, messageIDs []uint) ([]*Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	var changed []*Message
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var deliveries []*MessageDelivery
+		if err := tx.Where("user_id = ? AND message_id IN ? AND status = ?", userID, messageIDs, DeliveryStatusQueued).
+			Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.MessageID)
+		}
+
+		now := time.Now()
+		if err := tx.Model(&MessageDelivery{}).
+			Where("user_id = ? AND message_id IN ? AND status = ?", userID, ids, DeliveryStatusQueued).
+			Updates(map[string]interface{}{"status": DeliveryStatusDelivered, "delivered_at": now}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ?", ids).Find(&changed).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// 好友关系状态常量
+const (
+	FriendshipPending  = "pending"  // 好友请求等待对方处理
+	FriendshipAccepted = "accepted" // 已经是好友
+	FriendshipRejected = "rejected" // 好友请求被拒绝
+	FriendshipExpired  = "expired"  // 好友请求超时未处理
+)
+
+// 好友请求相关错误
+var (
+	ErrAlreadyFriends          = errors.New("已经是好友")
+	ErrFriendRequestPending    = errors.New("好友请求已发送")
+	ErrFriendRequestNotPending = errors.New("好友请求已处理或已过期")
+	ErrFriendRequestCooldown   = errors.New("好友请求被拒绝后需要等待一段时间才能再次发送")
+)
+
+// IsPendingRequest 是否为等待处理且未过期的好友请求
+func (f *Friendship) IsPendingRequest() bool {
+	return f.Status == FriendshipPending && (f.ExpiresAt == nil || f.ExpiresAt.After(time.Now()))
+}
+
+// GetFriendRequestByID 根据ID获取好友请求
+func GetFriendRequestByID(id uint) (*Friendship, error) {
+	var friendship Friendship
+	result := DB.First(&friendship, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &friendship, nil
+}
+
+// GetFriendRequests 获取等待处理的好友请求，incoming为true时获取别人发给自己的，否则获取自己发出的，按时间倒序排列
+func GetFriendRequests(userID uint, incoming bool) ([]*Friendship, error) {
+	column := "user_id"
+	if incoming {
+		column = "friend_id"
+	}
+
+	query := DB.Where(column+" = ? AND status = ?", userID, FriendshipPending).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	if incoming {
+		// 被屏蔽的用户发来的请求不显示
+		query = query.Where("NOT EXISTS (SELECT 1 FROM user_blocks WHERE user_blocks.user_id = friendships.friend_id AND user_blocks.blocked_id = friendships.user_id)")
+	}
+
+	var friendships []*Friendship
+	result := query.Order("id DESC").Find(&friendships)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return friendships, nil
+}
+
+// RespondFriendRequest 接受或拒绝好友请求，请求已被处理或已过期时返回ErrFriendRequestNotPending
+func RespondFriendRequest(friendship *Friendship, accept bool) error {
+	status := FriendshipRejected
+	if accept {
+		status = FriendshipAccepted
+	}
+
+	result := DB.Model(&Friendship{}).
+		Where("id = ? AND status = ?", friendship.ID, FriendshipPending).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Updates(map[string]interface{}{"status": status, "expires_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFriendRequestNotPending
+	}
+
+	friendship.Status = status
+	friendship.ExpiresAt = nil
+	return nil
+}
+
+// CancelFriendRequest 撤销自己发出的好友请求，请求已被处理时返回ErrFriendRequestNotPending
+func CancelFriendRequest(friendship *Friendship) error {
+	result := DB.Where("id = ? AND status = ?", friendship.ID, FriendshipPending).Delete(&Friendship{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFriendRequestNotPending
+	}
+	return nil
+}
+
+// ExpireFriendRequests 将超时未处理的好友请求标记为过期，返回处理的数量
+func ExpireFriendRequests() (int64, error) {
+	result := DB.Model(&Friendship{}).
+		Where("status = ? AND expires_at <= ?", FriendshipPending, time.Now()).
+		Update("status", FriendshipExpired)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FriendSetting 用户对好友的私有设置，只有设置者自己可见。
+// 好友关系由双方共用一条Friendship记录，因此备注等按设置者单独保存
+type FriendSetting struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_friend_setting" json:"-"`              // 设置者
+	FriendID  uint      `gorm:"not null;uniqueIndex:idx_friend_setting;index" json:"friendId"` // 好友
+	Alias     string    `gorm:"size:50" json:"alias"`                                          // 备注名，为空时显示好友的昵称
+	Tags      []string  `gorm:"type:text;serializer:json" json:"tags"`                         // 分组标签
+	Starred   bool      `gorm:"default:false" json:"starred"`                                  // 星标好友
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GetFriendSettings 获取用户对全部好友的设置，按好友ID索引
+func GetFriendSettings(userID uint) (map[uint]*FriendSetting, error) {
+	var list []*FriendSetting
+	if err := DB.Where("user_id = ?", userID).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	settings := make(map[uint]*FriendSetting, len(list))
+	for _, setting := range list {
+		settings[setting.FriendID] = setting
+	}
+	return settings, nil
+}
+
+// GetAliasesForFriend 获取userIDs中的用户给friendID设置的备注名，没有设置备注的用户不在结果中
+func GetAliasesForFriend(friendID uint, userIDs []uint) (map[uint]string, error) {
+	aliases := make(map[uint]string)
+	if len(userIDs) == 0 {
+		return aliases, nil
+	}
+
+	var list []*FriendSetting
+	err := DB.Select("user_id", "alias").
+		Where("friend_id = ? AND user_id IN ? AND alias <> ?", friendID, userIDs, "").
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, setting := range list {
+		aliases[setting.UserID] = setting.Alias
+	}
+	return aliases, nil
+}
+
+// UpdateFriendSettings 更新用户对好友的备注、标签和星标，为nil的设置保持不变
+func UpdateFriendSettings(userID, friendID uint, alias *string, tags *[]string, starred *bool) (*FriendSetting, error) {
+	var setting FriendSetting
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&FriendSetting{
+			UserID:   userID,
+			FriendID: friendID,
+			Tags:     []string{},
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND friend_id = ?", userID, friendID).
+			First(&setting).Error
+		if err != nil {
+			return err
+		}
+
+		if alias != nil {
+			setting.Alias = *alias
+		}
+		if tags != nil {
+			setting.Tags = *tags
+		}
+		if starred != nil {
+			setting.Starred = *starred
+		}
+		return tx.Save(&setting).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// DeleteFriendSettings 删除好友后清除双方对彼此的设置
+func DeleteFriendSettings(userID, friendID uint) error {
+	result := DB.Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)", userID, friendID, friendID, userID).
+		Delete(&FriendSetting{})
+	return result.Error
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// FriendSuggestionDismissal 用户忽略的好友推荐，被忽略的用户不会再出现在推荐中
+type FriendSuggestionDismissal struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_suggestion_dismissal" json:"userId"`
+	DismissedID uint      `gorm:"not null;uniqueIndex:idx_suggestion_dismissal" json:"dismissedId"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// FriendSuggestion 好友推荐的候选用户
+type FriendSuggestion struct {
+	UserID        uint // 被推荐的用户
+	MutualFriends int  // 共同好友数
+	SharedGroups  int  // 共同所在的群组数
+}
+
+// Score 推荐的排序分数，共同好友比共同群组更能说明双方认识
+func (s *FriendSuggestion) Score() int {
+	return s.MutualFriends*3 + s.SharedGroups
+}
+
+// ComputeFriendSuggestions 根据共同好友和共同群组计算用户的好友推荐，按分数从高到低返回最多limit个候选。
+// 只查询用户的好友和所在群组的成员（两跳以内），不遍历整个好友关系图。
+// 当前的好友和excluded中的用户在截取前去掉，避免排在前面的候选都被排除后结果不足
+func ComputeFriendSuggestions(userID uint, excluded map[uint]bool, limit int) ([]*FriendSuggestion, error) {
+	var friendships []*Friendship
+	err := DB.Where("(user_id = ? OR friend_id = ?) AND status = ?", userID, userID, FriendshipAccepted).
+		Find(&friendships).Error
+	if err != nil {
+		return nil, err
+	}
+	friendIDs := make([]uint, 0, len(friendships))
+	isFriend := make(map[uint]bool, len(friendships))
+	for _, friendship := range friendships {
+		friendID := friendship.FriendID
+		if friendID == userID {
+			friendID = friendship.UserID
+		}
+		if !isFriend[friendID] {
+			isFriend[friendID] = true
+			friendIDs = append(friendIDs, friendID)
+		}
+	}
+
+	candidates := make(map[uint]*FriendSuggestion)
+	candidate := func(id uint) *FriendSuggestion {
+		suggestion, ok := candidates[id]
+		if !ok {
+			suggestion = &FriendSuggestion{UserID: id}
+			candidates[id] = suggestion
+		}
+		return suggestion
+	}
+
+	// 好友的好友，每条好友关系中是自己好友的一方即为共同好友
+	if len(friendIDs) > 0 {
+		var secondDegree []*Friendship
+		err = DB.Select("user_id", "friend_id").
+			Where("(user_id IN ? OR friend_id IN ?) AND status = ?", friendIDs, friendIDs, FriendshipAccepted).
+			Find(&secondDegree).Error
+		if err != nil {
+			return nil, err
+		}
+		mutuals := make(map[uint]map[uint]bool)
+		for _, friendship := range secondDegree {
+			for _, pair := range [][2]uint{{friendship.UserID, friendship.FriendID}, {friendship.FriendID, friendship.UserID}} {
+				mutual, other := pair[0], pair[1]
+				if !isFriend[mutual] || other == userID {
+					continue
+				}
+				if mutuals[other] == nil {
+					mutuals[other] = make(map[uint]bool)
+				}
+				mutuals[other][mutual] = true
+			}
+		}
+		for id, set := range mutuals {
+			candidate(id).MutualFriends = len(set)
+		}
+	}
+
+	// 同群成员及共同所在的群组数
+	var shared []struct {
+		UserID uint
+		Count  int
+	}
+	err = DB.Table("group_members AS others").
+		Select("others.user_id AS user_id, COUNT(DISTINCT others.group_id) AS count").
+		Joins("JOIN group_members AS mine ON mine.group_id = others.group_id").
+		Where("mine.user_id = ? AND others.user_id <> ?", userID, userID).
+		Group("others.user_id").
+		Scan(&shared).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range shared {
+		candidate(row.UserID).SharedGroups = row.Count
+	}
+
+	suggestions := make([]*FriendSuggestion, 0, len(candidates))
+	for id, suggestion := range candidates {
+		if !isFriend[id] && !excluded[id] {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Score() != b.Score() {
+			return a.Score() > b.Score()
+		}
+		if a.MutualFriends != b.MutualFriends {
+			return a.MutualFriends > b.MutualFriends
+		}
+		return a.UserID < b.UserID
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// GetSuggestionExclusions 获取不应推荐给用户的用户：已经是好友或有未处理好友请求的、
+// 任一方屏蔽了对方的，以及用户忽略过的推荐
+func GetSuggestionExclusions(userID uint) (map[uint]bool, error) {
+	excluded := map[uint]bool{userID: true}
+
+	var friendships []*Friendship
+	err := DB.Select("user_id", "friend_id").
+		Where("(user_id = ? OR friend_id = ?) AND status IN ?", userID, userID, []string{FriendshipAccepted, FriendshipPending}).
+		Find(&friendships).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, friendship := range friendships {
+		excluded[friendship.UserID] = true
+		excluded[friendship.FriendID] = true
+	}
+
+	var blocks []*UserBlock
+	err = DB.Where("user_id = ? OR blocked_id = ?", userID, userID).Find(&blocks).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		excluded[block.UserID] = true
+		excluded[block.BlockedID] = true
+	}
+
+	var dismissedIDs []uint
+	err = DB.Model(&FriendSuggestionDismissal{}).Where("user_id = ?", userID).Pluck("dismissed_id", &dismissedIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range dismissedIDs {
+		excluded[id] = true
+	}
+	return excluded, nil
+}
+
+// DismissFriendSuggestion 忽略好友推荐，已经忽略时不做处理
+func DismissFriendSuggestion(userID, dismissedID uint) error {
+	dismissal := &FriendSuggestionDismissal{UserID: userID, DismissedID: dismissedID}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(dismissal)
+	return result.Error
+}
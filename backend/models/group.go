@@ -148,12 +148,51 @@ func UpdateGroup(group *Group) error {
 	return result.Error
 }
 
-// DeleteGroup 删除群组
-func DeleteGroup(groupID uint) error {
-	result := DB.Delete(&Group{}, groupID)
+// TransferGroupOwner 将群主转让给其他成员，新群主同时成为管理员
+func TransferGroupOwner(groupID, newOwnerID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Group{}).Where("id = ?", groupID).Update("creator_id", newOwnerID)
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Model(&GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, newOwnerID).
+			Update("role", "admin")
+		return result.Error
+	})
+}
+
+// UpdateGroupAvatar 更新群组头像地址
+func UpdateGroupAvatar(groupID uint, avatar string) error {
+	result := DB.Model(&Group{}).Where("id = ?", groupID).Update("avatar", avatar)
 	return result.Error
 }
 
+// DeleteGroup 删除群组及其成员，并清理群聊的会话、会话摘要、已读游标、@提及和未投递的消息，
+// 解散后群聊不再出现在成员的会话列表中，重新连接时也不会补发
+func DeleteGroup(groupID uint) error {
+	key := GroupConversationKey(groupID)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&MessageMention{}).Error; err != nil {
+			return err
+		}
+		err := tx.Where("message_id IN (?)", tx.Model(&Message{}).Select("id").Where("conversation_key = ?", key)).
+			Delete(&MessageDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&ReadCursor{}, &UserConversation{}, &Conversation{}} {
+			if err := tx.Where("conversation_key = ?", key).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Group{}, groupID).Error
+	})
+}
+
 // RemoveGroupMember 移除群组成员
 func RemoveGroupMember(groupID, userID uint) error {
 	result := DB.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&GroupMember{})
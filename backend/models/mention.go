@@ -0,0 +1,218 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// MentionAllKeyword @所有人的关键字
+const MentionAllKeyword = "all"
+
+// MessageMention 群聊消息中的@提及记录，每个被提及的用户一条
+type MessageMention struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	MessageID uint       `gorm:"not null;uniqueIndex:idx_mention_message_user" json:"messageId"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_mention_message_user;index:idx_mention_user_read" json:"userId"` // 被提及的用户
+	GroupID   uint       `gorm:"not null;index" json:"groupId"`
+	SenderID  uint       `gorm:"not null" json:"senderId"`
+	All       bool       `gorm:"default:false" json:"all"` // 是否仅通过@all被提及
+	Read      bool       `gorm:"default:false;index:idx_mention_user_read" json:"read"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// ParseMentions 从消息内容中解析@提及，usernames为可以被提及的用户名到用户ID的映射
+// 用户名之后必须是空白、标点或内容结尾，"@"之前必须是空白或内容开头，避免误识别邮箱地址
+func ParseMentions(content string, usernames map[string]uint) ([]uint, bool) {
+	var userIDs []uint
+	seen := make(map[uint]bool)
+	all := false
+
+	for i, r := range content {
+		if r != '@' {
+			continue
+		}
+		if i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(content[:i])
+			if !unicode.IsSpace(prev) {
+				continue
+			}
+		}
+
+		token := content[i+1:]
+		if end := strings.IndexFunc(token, unicode.IsSpace); end >= 0 {
+			token = token[:end]
+		}
+		if token == "" {
+			continue
+		}
+
+		// 取能匹配上的最长用户名，用户名本身可能包含标点
+		matched := ""
+		for username := range usernames {
+			if len(username) > len(matched) && mentionMatches(token, username) {
+				matched = username
+			}
+		}
+
+		// @all优先于名为all的用户
+		if len(matched) <= len(MentionAllKeyword) && mentionMatches(token, MentionAllKeyword) {
+			all = true
+			continue
+		}
+		if matched != "" {
+			if userID := usernames[matched]; !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+
+	return userIDs, all
+}
+
+// mentionMatches 判断@之后的内容是否以指定名称开头且名称之后没有紧跟其他字符
+func mentionMatches(token, name string) bool {
+	if !strings.HasPrefix(token, name) {
+		return false
+	}
+	if len(token) == len(name) {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(token[len(name):])
+	return unicode.IsPunct(next) || unicode.IsSymbol(next)
+}
+
+// createMentions 在事务中为群聊消息创建提及记录
+func createMentions(tx *gorm.DB, message *Message) error {
+	allMentioned := make(map[uint]bool)
+	if message.MentionAll {
+		var memberIDs []uint
+		if err := tx.Model(&GroupMember{}).Where("group_id = ?", message.GroupID).Pluck("user_id", &memberIDs).Error; err != nil {
+			return err
+		}
+		for _, memberID := range memberIDs {
+			allMentioned[memberID] = true
+		}
+	}
+
+	mentions := make([]*MessageMention, 0, len(message.Mentions)+len(allMentioned))
+	for _, userID := range message.Mentions {
+		if userID == message.SenderID {
+			continue
+		}
+		mentions = append(mentions, &MessageMention{
+			MessageID: message.ID,
+			UserID:    userID,
+			GroupID:   message.GroupID,
+			SenderID:  message.SenderID,
+		})
+		delete(allMentioned, userID)
+	}
+	for userID := range allMentioned {
+		if userID == message.SenderID {
+			continue
+		}
+		mentions = append(mentions, &MessageMention{
+			MessageID: message.ID,
+			UserID:    userID,
+			GroupID:   message.GroupID,
+			SenderID:  message.SenderID,
+			All:       true,
+		})
+	}
+
+	if len(mentions) == 0 {
+		return nil
+	}
+	return tx.Create(&mentions).Error
+}
+
+// GetMentionedUserIDs 获取消息提及到的全部用户（包括通过@all提及的）
+func GetMentionedUserIDs(messageID uint) ([]uint, error) {
+	var userIDs []uint
+	result := DB.Model(&MessageMention{}).Where("message_id = ?", messageID).Pluck("user_id", &userIDs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return userIDs, nil
+}
+
+// LoadMentions 为消息批量填充被单独@的用户ID
+func LoadMentions(messages []*Message) error {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		if message.Type == MessageTypeGroup {
+			ids = append(ids, message.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var mentions []*MessageMention
+	if err := DB.Where("message_id IN ? AND `all` = ?", ids, false).Order("id ASC").Find(&mentions).Error; err != nil {
+		return err
+	}
+
+	byMessage := make(map[uint][]uint)
+	for _, mention := range mentions {
+		byMessage[mention.MessageID] = append(byMessage[mention.MessageID], mention.UserID)
+	}
+	for _, message := range messages {
+		if message.Type == MessageTypeGroup {
+			message.Mentions = byMessage[message.ID]
+		}
+	}
+	return nil
+}
+
+// GetUnreadMentions 获取用户在所有群组中未读的提及，按时间倒序
+// 只返回用户仍是成员的群组中、未撤回且未被自己删除的消息；beforeID不为0时只返回更早的提及
+func GetUnreadMentions(userID, beforeID uint, limit int) ([]*MessageMention, error) {
+	query := DB.Model(&MessageMention{}).
+		Joins("JOIN messages ON messages.id = message_mentions.message_id").
+		Joins("JOIN group_members ON group_members.group_id = message_mentions.group_id AND group_members.user_id = message_mentions.user_id").
+		Where("message_mentions.user_id = ? AND message_mentions.read = ?", userID, false).
+		Where("messages.recalled = ?", false).
+		Where("NOT EXISTS (SELECT 1 FROM message_hiddens WHERE message_hiddens.message_id = message_mentions.message_id AND message_hiddens.user_id = ?)", userID)
+	if beforeID != 0 {
+		query = query.Where("message_mentions.id < ?", beforeID)
+	}
+
+	var mentions []*MessageMention
+	result := query.Select("message_mentions.*").
+		Order("message_mentions.id DESC").
+		Limit(limit).
+		Find(&mentions)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return mentions, nil
+}
+
+// MarkMentionsRead 将用户在指定消息上的提及标记为已读
+func MarkMentionsRead(userID uint, messageIDs []uint) (int64, error) {
+	if len(messageIDs) == 0 {
+		return 0, nil
+	}
+
+	result := DB.Model(&MessageMention{}).
+		Where("user_id = ? AND message_id IN ? AND `read` = ?", userID, messageIDs, false).
+		Updates(map[string]interface{}{"read": true, "read_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// MarkGroupMentionsRead 将用户在某个群组中的全部提及标记为已读
+func MarkGroupMentionsRead(userID, groupID uint) (int64, error) {
+	result := DB.Model(&MessageMention{}).
+		Where("user_id = ? AND group_id = ? AND `read` = ?", userID, groupID, false).
+		Updates(map[string]interface{}{"read": true, "read_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	usernames := map[string]uint{
+		"alice":     1,
+		"bob":       2,
+		"bob.smith": 3,
+		"all":       4,
+		"张三":        5,
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantIDs []uint
+		wantAll bool
+	}{
+		{"no mention", "hello world", nil, false},
+		{"single", "@alice hi", []uint{1}, false},
+		{"at end", "hi @alice", []uint{1}, false},
+		{"followed by punctuation", "@alice, @bob!", []uint{1, 2}, false},
+		{"longest username wins", "@bob.smith hi", []uint{3}, false},
+		{"duplicates removed", "@alice @alice", []uint{1}, false},
+		{"email is not a mention", "mail alice@bob.com", nil, false},
+		{"unknown user", "@carol hi", nil, false},
+		{"prefix of longer word", "@alicex hi", nil, false},
+		{"all keyword", "@all 开会", nil, true},
+		{"all with users", "@all @bob", []uint{2}, true},
+		{"chinese username", "你好 @张三。", []uint{5}, false},
+		{"lone at sign", "@ alice", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, all := ParseMentions(tt.content, usernames)
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if all != tt.wantAll {
+				t.Errorf("all = %v, want %v", all, tt.wantAll)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // 消息类型常量
@@ -12,18 +16,164 @@ const (
 
 // Message MySQL中的消息模型
 type Message struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	Type       string    `gorm:"size:20;not null" json:"type"` // private, group
-	SenderID   uint      `gorm:"not null;index" json:"senderId"`
-	ReceiverID uint      `gorm:"index" json:"receiverId,omitempty"` // 私聊时的接收者ID
-	GroupID    uint      `gorm:"index" json:"groupId,omitempty"`    // 群聊时的群组ID
-	Content    string    `gorm:"type:text;not null" json:"content"`
-	Timestamp  time.Time `gorm:"index" json:"timestamp"`
-	Read       bool      `gorm:"default:false" json:"read"` // 消息是否已读
+	ID                uint              `gorm:"primaryKey" json:"id"`
+	Type              string            `gorm:"size:20;not null" json:"type"`                // private, group
+	Kind              string            `gorm:"size:20;not null;default:'text'" json:"kind"` // 内容类型，见MessageKind常量
+	Payload           json.RawMessage   `gorm:"type:text" json:"payload,omitempty"`          // 与内容类型对应的结构化数据，文本消息为空
+	SenderID          uint              `gorm:"not null;index" json:"senderId"`
+	ReceiverID        uint              `gorm:"index" json:"receiverId,omitempty"`                                  // 私聊时的接收者ID
+	GroupID           uint              `gorm:"index" json:"groupId,omitempty"`                                     // 群聊时的群组ID
+	ConversationKey   string            `gorm:"size:50;index:idx_messages_conversation_seq" json:"conversationKey"` // 所属会话标识
+	Seq               uint64            `gorm:"index:idx_messages_conversation_seq" json:"seq"`                     // 会话内序列号
+	Content           string            `gorm:"type:text;not null" json:"content"`
+	Timestamp         time.Time         `gorm:"index" json:"timestamp"`
+	Read              bool              `gorm:"default:false" json:"read"`     // 私聊消息接收者是否已读
+	Edited            bool              `gorm:"default:false" json:"edited"`   // 是否被编辑过
+	EditedAt          *time.Time        `json:"editedAt,omitempty"`            // 最后编辑时间
+	Recalled          bool              `gorm:"default:false" json:"recalled"` // 是否已撤回，撤回后内容被清空
+	RecalledAt        *time.Time        `json:"recalledAt,omitempty"`
+	RecalledBy        uint              `json:"recalledBy,omitempty"`                // 撤回操作者，可能是发送者或群管理员
+	ReplyToID         *uint             `gorm:"index" json:"replyToId,omitempty"`    // 引用回复的消息ID
+	ReplyTo           *MessagePreview   `gorm:"-" json:"replyTo,omitempty"`          // 被引用消息的预览，查询时填充
+	ThreadRootID      *uint             `gorm:"index" json:"threadRootId,omitempty"` // 所属话题的根消息ID，为空表示在主时间线中
+	ThreadReplyCount  int               `gorm:"default:0" json:"threadReplyCount"`   // 作为话题根消息时的回复数
+	ThreadLastReplyAt *time.Time        `json:"threadLastReplyAt,omitempty"`         // 作为话题根消息时的最后回复时间
+	ReadCount         int               `gorm:"-" json:"readCount,omitempty"`        // 群聊消息的已读人数（不含发送者），查询时填充
+	MentionAll        bool              `gorm:"default:false" json:"mentionAll"`     // 是否@所有人
+	Mentions          []uint            `gorm:"-" json:"mentions,omitempty"`         // 被单独@的用户ID，查询时填充
+	Reactions         []ReactionSummary `gorm:"-" json:"reactions,omitempty"`        // 表情回应汇总，查询时填充
+	Attachments       []*Attachment     `gorm:"-" json:"attachments,omitempty"`      // 消息附件，查询时填充
+}
+
+// MessagePreview 被引用消息的简要预览
+type MessagePreview struct {
+	ID             uint      `json:"id"`
+	SenderID       uint      `json:"senderId"`
+	SenderUsername string    `json:"senderUsername"`
+	Kind           string    `json:"kind"`
+	Content        string    `json:"content"` // 截断后的内容，非文本消息为摘要，已撤回时为空
+	Timestamp      time.Time `json:"timestamp"`
+	Recalled       bool      `json:"recalled"`
+}
+
+// previewContentLength 预览内容的最大字符数
+const previewContentLength = 100
+
+// SaveMessageOptions 保存消息时的可选参数
+type SaveMessageOptions struct {
+	ReplyToID      uint            // 引用回复的消息ID，0表示不引用
+	ThreadRootID   uint            // 话题根消息ID，0表示发送到主时间线
+	MentionUserIDs []uint          // 被@的用户ID，仅群聊有效
+	MentionAll     bool            // 是否@所有人，仅群聊有效
+	AttachmentIDs  []uint          // 随消息发送的附件ID，必须是发送者上传且尚未使用的附件
+	Kind           string          // 内容类型，为空时为文本
+	Payload        json.RawMessage // 已校验的结构化数据
+	Shadow         bool            // 私聊接收者屏蔽了发送者，消息只对发送者可见
+}
+
+// apply 将可选参数写入消息
+func (o SaveMessageOptions) apply(message *Message) {
+	message.Kind = MessageKindText
+	if o.Kind != "" {
+		message.Kind = o.Kind
+		message.Payload = o.Payload
+	}
+	if o.ReplyToID != 0 {
+		replyToID := o.ReplyToID
+		message.ReplyToID = &replyToID
+	}
+	if o.ThreadRootID != 0 {
+		threadRootID := o.ThreadRootID
+		message.ThreadRootID = &threadRootID
+	}
+	if message.Type == MessageTypeGroup {
+		message.Mentions = o.MentionUserIDs
+		message.MentionAll = o.MentionAll
+	}
+}
+
+// MessageRevision 消息被编辑前的历史版本
+type MessageRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;index" json:"messageId"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	CreatedAt time.Time `json:"createdAt"` // 该版本被替换的时间
+}
+
+// conversationKey 消息所属会话的标识
+func (m *Message) conversationKey() string {
+	if m.Type == MessageTypeGroup {
+		return GroupConversationKey(m.GroupID)
+	}
+	return PrivateConversationKey(m.SenderID, m.ReceiverID)
+}
+
+// saveMessage 在事务中分配会话序列号并保存消息，同时关联附件
+func saveMessage(message *Message, opts SaveMessageOptions) error {
+	message.ConversationKey = message.conversationKey()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.ConversationKey, message.Type)
+		if err != nil {
+			return err
+		}
+		message.Seq = seq
+
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+
+		err = tx.Create(&ConversationChange{
+			ConversationKey: message.ConversationKey,
+			Seq:             seq,
+			Kind:            ChangeKindMessage,
+			MessageID:       message.ID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(opts.AttachmentIDs) > 0 {
+			if err := attachToMessage(tx, message, opts.AttachmentIDs); err != nil {
+				return err
+			}
+		}
+
+		// 屏蔽的消息对接收者隐藏，也不计入接收者的未读数和会话摘要；发送者的会话列表照常更新，
+		// 避免发送者从自己的会话列表中察觉被屏蔽
+		var shadowedIDs []uint
+		if opts.Shadow && message.Type == MessageTypePrivate {
+			if err := tx.Create(&MessageHidden{MessageID: message.ID, UserID: message.ReceiverID}).Error; err != nil {
+				return err
+			}
+			shadowedIDs = append(shadowedIDs, message.ReceiverID)
+		}
+
+		if (len(message.Mentions) > 0 || message.MentionAll) && len(shadowedIDs) == 0 {
+			if err := createMentions(tx, message); err != nil {
+				return err
+			}
+		}
+
+		if message.ThreadRootID == nil {
+			return touchConversation(tx, message, shadowedIDs...)
+		}
+
+		// 更新话题根消息的回复数和最后回复时间
+		err = tx.Model(&Message{}).Where("id = ?", *message.ThreadRootID).Updates(map[string]interface{}{
+			"thread_reply_count":   gorm.Expr("thread_reply_count + 1"),
+			"thread_last_reply_at": message.Timestamp,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		_, err = appendChange(tx, message.ConversationKey, message.Type, ChangeKindThread, *message.ThreadRootID)
+		return err
+	})
 }
 
 // SavePrivateMessage 保存私聊消息到MySQL
-func SavePrivateMessage(senderID, receiverID uint, content string) (*Message, error) {
+func SavePrivateMessage(senderID, receiverID uint, content string, opts SaveMessageOptions) (*Message, error) {
 	message := &Message{
 		Type:       MessageTypePrivate,
 		SenderID:   senderID,
@@ -32,17 +182,17 @@ func SavePrivateMessage(senderID, receiverID uint, content string) (*Message, er
 		Timestamp:  time.Now(),
 		Read:       false,
 	}
+	opts.apply(message)
 
-	result := DB.Create(message)
-	if result.Error != nil {
-		return nil, result.Error
+	if err := saveMessage(message, opts); err != nil {
+		return nil, err
 	}
 
 	return message, nil
 }
 
 // SaveGroupMessage 保存群聊消息到MySQL
-func SaveGroupMessage(senderID, groupID uint, content string) (*Message, error) {
+func SaveGroupMessage(senderID, groupID uint, content string, opts SaveMessageOptions) (*Message, error) {
 	message := &Message{
 		Type:      MessageTypeGroup,
 		SenderID:  senderID,
@@ -51,54 +201,321 @@ func SaveGroupMessage(senderID, groupID uint, content string) (*Message, error)
 		Timestamp: time.Now(),
 		Read:      false,
 	}
+	opts.apply(message)
 
-	result := DB.Create(message)
-	if result.Error != nil {
-		return nil, result.Error
+	if err := saveMessage(message, opts); err != nil {
+		return nil, err
 	}
 
 	return message, nil
 }
 
-// GetPrivateMessages 获取私聊消息（支持分页）
-func GetPrivateMessages(userID, friendID uint, limit, offset int) ([]*Message, error) {
-	var messages []*Message
-	result := DB.Where("type = ? AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))", 
-		MessageTypePrivate, userID, friendID, friendID, userID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&messages)
-	
+// GetMessageByID 根据ID获取消息
+func GetMessageByID(id uint) (*Message, error) {
+	var message Message
+	result := DB.First(&message, id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	return &message, nil
+}
+
+// EditMessage 修改消息内容，旧内容保存为历史版本并记录会话变更
+func EditMessage(message *Message, content string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		revision := &MessageRevision{
+			MessageID: message.ID,
+			Content:   message.Content,
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
 
-	return messages, nil
+		now := time.Now()
+		err := tx.Model(message).Updates(map[string]interface{}{
+			"content":   content,
+			"edited":    true,
+			"edited_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		_, err = appendChange(tx, message.ConversationKey, message.Type, ChangeKindEdit, message.ID)
+		if err != nil {
+			return err
+		}
+
+		message.Content = content
+		message.Edited = true
+		message.EditedAt = &now
+		return nil
+	})
 }
 
-// GetGroupMessages 获取群聊消息（支持分页）
-func GetGroupMessages(groupID uint, limit, offset int) ([]*Message, error) {
-	var messages []*Message
-	result := DB.Where("type = ? AND group_id = ?", MessageTypeGroup, groupID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&messages)
-	
+// GetMessageRevisions 获取消息的历史版本，按时间先后排序
+func GetMessageRevisions(messageID uint) ([]*MessageRevision, error) {
+	var revisions []*MessageRevision
+	result := DB.Where("message_id = ?", messageID).Order("id ASC").Find(&revisions)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	return revisions, nil
+}
 
-	return messages, nil
+// LoadReplyPreviews 为引用了其他消息的消息批量填充被引用消息的预览
+func LoadReplyPreviews(messages []*Message) error {
+	ids := make([]uint, 0)
+	for _, message := range messages {
+		if message.ReplyToID != nil {
+			ids = append(ids, *message.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	previews, err := GetMessagePreviews(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if message.ReplyToID == nil {
+			continue
+		}
+		if preview, ok := previews[*message.ReplyToID]; ok {
+			message.ReplyTo = preview
+		}
+	}
+	return nil
 }
 
-// MarkMessagesAsRead 标记消息为已读
-func MarkMessagesAsRead(messageIDs []uint) error {
-	if len(messageIDs) == 0 {
+// GetMessagePreviews 批量获取消息的简要预览，以消息ID为键
+func GetMessagePreviews(ids []uint) (map[uint]*MessagePreview, error) {
+	previews := make(map[uint]*MessagePreview, len(ids))
+	messages, err := GetMessagesByIDs(ids)
+	if err != nil || len(messages) == 0 {
+		return previews, err
+	}
+
+	senderIDs := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		senderIDs = append(senderIDs, message.SenderID)
+	}
+	var senders []*User
+	if err := DB.Where("id IN ?", senderIDs).Find(&senders).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(senders))
+	for _, sender := range senders {
+		usernames[sender.ID] = sender.Username
+	}
+
+	for _, message := range messages {
+		previews[message.ID] = &MessagePreview{
+			ID:             message.ID,
+			SenderID:       message.SenderID,
+			SenderUsername: usernames[message.SenderID],
+			Kind:           message.Kind,
+			Content:        truncateRunes(message.Content, previewContentLength),
+			Timestamp:      message.Timestamp,
+			Recalled:       message.Recalled,
+		}
+	}
+	return previews, nil
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// MessageHidden 用户"仅对自己删除"的消息
+type MessageHidden struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_hidden_message_user" json:"messageId"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_hidden_message_user;index" json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RecallMessage 撤回消息（对所有人删除），清空内容并记录会话变更
+func RecallMessage(message *Message, operatorID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(message).Updates(map[string]interface{}{
+			"content":     "",
+			"payload":     nil,
+			"recalled":    true,
+			"recalled_at": now,
+			"recalled_by": operatorID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// 编辑历史中的旧内容和表情回应一并删除
+		if err := tx.Where("message_id = ?", message.ID).Delete(&MessageRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", message.ID).Delete(&MessageReaction{}).Error; err != nil {
+			return err
+		}
+
+		_, err = appendChange(tx, message.ConversationKey, message.Type, ChangeKindRecall, message.ID)
+		if err != nil {
+			return err
+		}
+
+		message.Content = ""
+		message.Payload = nil
+		message.Recalled = true
+		message.RecalledAt = &now
+		message.RecalledBy = operatorID
+		message.Attachments = nil
 		return nil
+	})
+}
+
+// HideMessage 将消息对指定用户隐藏（仅对自己删除），并写入只对该用户可见的会话变更，
+// 用户离线的其他设备通过增量同步得知删除。已经隐藏时不做处理
+func HideMessage(message *Message, userID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		hidden := &MessageHidden{MessageID: message.ID, UserID: userID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(hidden)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		_, err := appendUserChange(tx, message.ConversationKey, message.Type, ChangeKindHidden, message.ID, userID)
+		return err
+	})
+}
+
+// GetHiddenMessageIDs 返回给定消息中对用户隐藏的消息ID集合
+func GetHiddenMessageIDs(userID uint, messageIDs []uint) (map[uint]bool, error) {
+	hidden := make(map[uint]bool)
+	if len(messageIDs) == 0 {
+		return hidden, nil
+	}
+
+	var ids []uint
+	err := DB.Model(&MessageHidden{}).
+		Where("user_id = ? AND message_id IN ?", userID, messageIDs).
+		Pluck("message_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hidden[id] = true
+	}
+	return hidden, nil
+}
+
+// 消息分页大小
+const (
+	DefaultMessagePageSize = 20  // 默认每页条数
+	MaxMessagePageSize     = 100 // 服务端允许的每页最大条数
+)
+
+// MessagePage 基于消息ID的游标分页参数，BeforeID和AfterID至多设置一个
+type MessagePage struct {
+	ViewerID uint // 查看者ID，用于过滤其"仅对自己删除"的消息
+	BeforeID uint // 获取ID小于该值的更早消息
+	AfterID  uint // 获取ID大于该值的更新消息
+	Limit    int
+}
+
+// normalizedLimit 返回限制在合法范围内的每页条数
+func (p MessagePage) normalizedLimit() int {
+	if p.Limit <= 0 {
+		return DefaultMessagePageSize
+	}
+	if p.Limit > MaxMessagePageSize {
+		return MaxMessagePageSize
 	}
-	
-	result := DB.Model(&Message{}).Where("id IN ?", messageIDs).Update("read", true)
-	return result.Error
-}
\ No newline at end of file
+	return p.Limit
+}
+
+// getConversationMessages 按游标获取会话主时间线中的一页消息，话题回复不包含在内
+func getConversationMessages(conversationKey string, page MessagePage) ([]*Message, bool, error) {
+	query := DB.Where("conversation_key = ? AND thread_root_id IS NULL", conversationKey)
+	return paginateMessages(query, page)
+}
+
+// paginateMessages 按游标获取一页消息，结果按ID降序排列，
+// hasMore表示沿分页方向是否还有更多消息
+func paginateMessages(query *gorm.DB, page MessagePage) ([]*Message, bool, error) {
+	limit := page.normalizedLimit()
+	query = query.Where("NOT EXISTS (SELECT 1 FROM message_hiddens WHERE message_hiddens.message_id = messages.id AND message_hiddens.user_id = ?)", page.ViewerID)
+
+	var messages []*Message
+	if page.AfterID > 0 {
+		query = query.Where("id > ?", page.AfterID).Order("id ASC")
+	} else {
+		if page.BeforeID > 0 {
+			query = query.Where("id < ?", page.BeforeID)
+		}
+		query = query.Order("id DESC")
+	}
+
+	// 多取一条用于判断是否还有下一页
+	result := query.Limit(limit + 1).Find(&messages)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	// 向后翻页时按升序查询，统一转为降序返回
+	if page.AfterID > 0 {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	return messages, hasMore, nil
+}
+
+// GetPrivateMessages 获取私聊消息（支持游标分页）
+func GetPrivateMessages(userID, friendID uint, page MessagePage) ([]*Message, bool, error) {
+	page.ViewerID = userID
+	return getConversationMessages(PrivateConversationKey(userID, friendID), page)
+}
+
+// GetGroupMessages 获取群聊消息（支持游标分页），page.ViewerID需设置为查看者
+func GetGroupMessages(groupID uint, page MessagePage) ([]*Message, bool, error) {
+	return getConversationMessages(GroupConversationKey(groupID), page)
+}
+
+// GetThreadMessages 获取话题中的回复（支持游标分页），page.ViewerID需设置为查看者
+func GetThreadMessages(rootID uint, page MessagePage) ([]*Message, bool, error) {
+	query := DB.Where("thread_root_id = ?", rootID)
+	return paginateMessages(query, page)
+}
+
+// GetThreadParticipantIDs 获取话题参与者：根消息发送者和所有回复过的用户
+func GetThreadParticipantIDs(root *Message) ([]uint, error) {
+	var senderIDs []uint
+	err := DB.Model(&Message{}).
+		Where("thread_root_id = ?", root.ID).
+		Distinct().
+		Pluck("sender_id", &senderIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	participants := []uint{root.SenderID}
+	for _, senderID := range senderIDs {
+		if senderID != root.SenderID {
+			participants = append(participants, senderID)
+		}
+	}
+	return participants, nil
+}
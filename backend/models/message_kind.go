@@ -0,0 +1,127 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// 消息内容类型常量
+const (
+	MessageKindText     = "text"     // 纯文本，没有payload
+	MessageKindImage    = "image"    // 图片，payload为ImagePayload
+	MessageKindFile     = "file"     // 文件，payload为FilePayload
+	MessageKindVoice    = "voice"    // 语音，payload为VoicePayload
+	MessageKindLocation = "location" // 位置，payload为LocationPayload
+	MessageKindCard     = "card"     // 用户或群组名片，payload为CardPayload
+	MessageKindSystem   = "system"   // 系统通知，只能由服务端生成，payload为SystemPayload
+)
+
+// 名片类型常量
+const (
+	CardTypeUser  = "user"
+	CardTypeGroup = "group"
+)
+
+// 系统通知事件常量
+const (
+	SystemEventGroupCreated       = "group_created"       // 创建群组
+	SystemEventMemberAdded        = "member_added"        // 邀请成员加入
+	SystemEventMemberRemoved      = "member_removed"      // 管理员移除成员
+	SystemEventMemberLeft         = "member_left"         // 成员主动退出
+	SystemEventGroupRenamed       = "group_renamed"       // 修改群名称
+	SystemEventDescriptionChanged = "description_changed" // 修改群介绍
+	SystemEventAvatarChanged      = "avatar_changed"      // 修改群头像
+	SystemEventOwnerTransferred   = "owner_transferred"   // 转让群主
+)
+
+// ImagePayload 图片消息
+type ImagePayload struct {
+	AttachmentID uint   `json:"attachmentId"`
+	Caption      string `json:"caption,omitempty"` // 图片说明
+}
+
+// FilePayload 文件消息
+type FilePayload struct {
+	AttachmentID uint   `json:"attachmentId"`
+	FileName     string `json:"fileName"` // 发送时由服务端根据附件填充
+	Size         int64  `json:"size"`
+}
+
+// VoicePayload 语音消息
+type VoicePayload struct {
+	AttachmentID uint    `json:"attachmentId"`
+	Duration     float64 `json:"duration"` // 时长，单位秒
+}
+
+// LocationPayload 位置消息
+type LocationPayload struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`    // 地点名称
+	Address   string  `json:"address,omitempty"` // 详细地址
+}
+
+// CardPayload 名片消息，名称和头像为发送时的快照
+type CardPayload struct {
+	CardType string `json:"cardType"` // user, group
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Avatar   string `json:"avatar"`
+}
+
+// SystemPayload 系统通知
+type SystemPayload struct {
+	Event      string `json:"event"`
+	OperatorID uint   `json:"operatorId,omitempty"` // 执行操作的用户
+	UserIDs    []uint `json:"userIds,omitempty"`    // 被操作的用户
+	Value      string `json:"value,omitempty"`      // 修改后的值，如新的群名称
+}
+
+// DecodeMessagePayload 严格解析消息payload，不允许未知字段
+func DecodeMessagePayload(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("payload后有多余的内容")
+	}
+	return nil
+}
+
+// EncodeMessagePayload 将payload编码为保存的JSON
+func EncodeMessagePayload(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+// MessageKindSummary 非文本消息的纯文本摘要，保存为消息内容，用于会话列表、引用预览和不支持该类型的客户端
+func MessageKindSummary(payload interface{}) string {
+	switch p := payload.(type) {
+	case *ImagePayload:
+		if p.Caption != "" {
+			return "[图片] " + p.Caption
+		}
+		return "[图片]"
+	case *FilePayload:
+		return "[文件] " + p.FileName
+	case *VoicePayload:
+		return fmt.Sprintf("[语音] %d秒", int(p.Duration+0.5))
+	case *LocationPayload:
+		if p.Name != "" {
+			return "[位置] " + p.Name
+		}
+		return "[位置]"
+	case *CardPayload:
+		if p.CardType == CardTypeGroup {
+			return "[群名片] " + p.Name
+		}
+		return "[个人名片] " + p.Name
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageReaction 用户对消息的表情回应，同一用户对同一消息的同一表情只记录一次
+type MessageReaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_reaction_message_user_emoji" json:"messageId"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_reaction_message_user_emoji" json:"userId"`
+	Emoji     string    `gorm:"size:32;not null;uniqueIndex:idx_reaction_message_user_emoji" json:"emoji"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ReactionSummary 某个表情在消息上的汇总
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reactedByMe"`
+}
+
+// AddReaction 添加表情回应并记录会话变更，已存在时返回false
+func AddReaction(message *Message, userID uint, emoji string) (bool, error) {
+	added := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MessageReaction{
+			MessageID: message.ID,
+			UserID:    userID,
+			Emoji:     emoji,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		added = true
+		_, err := appendChange(tx, message.ConversationKey, message.Type, ChangeKindReaction, message.ID)
+		return err
+	})
+	return added, err
+}
+
+// RemoveReaction 移除表情回应并记录会话变更，不存在时返回false
+func RemoveReaction(message *Message, userID uint, emoji string) (bool, error) {
+	removed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("message_id = ? AND user_id = ? AND emoji = ?", message.ID, userID, emoji).
+			Delete(&MessageReaction{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		removed = true
+		_, err := appendChange(tx, message.ConversationKey, message.Type, ChangeKindReaction, message.ID)
+		return err
+	})
+	return removed, err
+}
+
+// GetReactionSummaries 按消息汇总表情回应，viewerID用于计算"我是否回应过"，为0时不计算
+func GetReactionSummaries(messageIDs []uint, viewerID uint) (map[uint][]ReactionSummary, error) {
+	summaries := make(map[uint][]ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	var reactions []*MessageReaction
+	if err := DB.Where("message_id IN ?", messageIDs).Order("id ASC").Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+
+	// 按表情第一次出现的先后排序
+	index := make(map[uint]map[string]int)
+	for _, reaction := range reactions {
+		if index[reaction.MessageID] == nil {
+			index[reaction.MessageID] = make(map[string]int)
+		}
+		i, ok := index[reaction.MessageID][reaction.Emoji]
+		if !ok {
+			i = len(summaries[reaction.MessageID])
+			index[reaction.MessageID][reaction.Emoji] = i
+			summaries[reaction.MessageID] = append(summaries[reaction.MessageID], ReactionSummary{Emoji: reaction.Emoji})
+		}
+		summaries[reaction.MessageID][i].Count++
+		if viewerID != 0 && reaction.UserID == viewerID {
+			summaries[reaction.MessageID][i].ReactedByMe = true
+		}
+	}
+
+	// 回应多的表情排在前面
+	for _, list := range summaries {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	}
+	return summaries, nil
+}
+
+// LoadReactions 为消息批量填充表情回应汇总
+func LoadReactions(messages []*Message, viewerID uint) error {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	summaries, err := GetReactionSummaries(ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		message.Reactions = summaries[message.ID]
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReadCursor 用户在会话中的已读位置，会话中ID不大于LastReadMessageID的消息都视为已读
+type ReadCursor struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	ConversationKey   string    `gorm:"size:50;not null;uniqueIndex:idx_read_cursor_conversation_user" json:"conversationKey"`
+	UserID            uint      `gorm:"not null;uniqueIndex:idx_read_cursor_conversation_user;index" json:"userId"`
+	LastReadMessageID uint      `gorm:"not null;default:0" json:"lastReadMessageId"`
+	ReadAt            time.Time `json:"readAt"` // 最后一次推进已读位置的时间
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// MarkConversationRead 将用户在会话中的已读位置推进到messageID，已读位置只增不减
+// 同时更新会话未读数，以及该范围内的私聊已读标记、投递状态和@提及；返回推进前的已读位置，未推进时返回false
+func MarkConversationRead(conversationKey string, userID, messageID uint) (uint, bool, error) {
+	var previous uint
+	advanced := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ReadCursor{
+			ConversationKey: conversationKey,
+			UserID:          userID,
+			ReadAt:          time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var cursor ReadCursor
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_key = ? AND user_id = ?", conversationKey, userID).
+			First(&cursor).Error
+		if err != nil {
+			return err
+		}
+		previous = cursor.LastReadMessageID
+		if cursor.LastReadMessageID >= messageID {
+			return nil
+		}
+
+		now := time.Now()
+		err = tx.Model(&cursor).Updates(map[string]interface{}{
+			"last_read_message_id": messageID,
+			"read_at":              now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		advanced = true
+
+		if err := refreshUnreadCount(tx, conversationKey, userID, messageID); err != nil {
+			return err
+		}
+
+		// 本次新读到的、由其他人发送的消息
+		newlyRead := tx.Model(&Message{}).Select("id").
+			Where("conversation_key = ? AND id > ? AND id <= ? AND sender_id <> ?", conversationKey, previous, messageID, userID)
+
+		err = tx.Model(&Message{}).
+			Where("conversation_key = ? AND id > ? AND id <= ?", conversationKey, previous, messageID).
+			Where("type = ? AND receiver_id = ? AND `read` = ?", MessageTypePrivate, userID, false).
+			Update("read", true).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&MessageDelivery{}).
+			Where("user_id = ? AND status <> ? AND message_id IN (?)", userID, DeliveryStatusRead, newlyRead).
+			Updates(map[string]interface{}{
+				"status":       DeliveryStatusRead,
+				"read_at":      now,
+				"delivered_at": gorm.Expr("COALESCE(delivered_at, ?)", now),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&MessageMention{}).
+			Where("user_id = ? AND `read` = ? AND message_id IN (?)", userID, false, newlyRead).
+			Updates(map[string]interface{}{"read": true, "read_at": now}).Error
+	})
+	return previous, advanced, err
+}
+
+// GetReadCursor 获取用户在会话中的已读位置，没有记录时返回零值
+func GetReadCursor(conversationKey string, userID uint) (*ReadCursor, error) {
+	var cursor ReadCursor
+	result := DB.Where("conversation_key = ? AND user_id = ?", conversationKey, userID).Limit(1).Find(&cursor)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &cursor, nil
+}
+
+// GetSendersInRange 获取会话中ID在(afterID, uptoID]范围内、除excludeID外的全部消息发送者
+func GetSendersInRange(conversationKey string, afterID, uptoID, excludeID uint) ([]uint, error) {
+	var senderIDs []uint
+	result := DB.Model(&Message{}).
+		Where("conversation_key = ? AND id > ? AND id <= ? AND sender_id <> ?", conversationKey, afterID, uptoID, excludeID).
+		Distinct().
+		Pluck("sender_id", &senderIDs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return senderIDs, nil
+}
+
+// readCursorQuery 查询会话中当前成员的已读位置，群聊中已退群用户的已读位置不再计入
+func readCursorQuery(conversationKey, conversationType string, groupID uint) *gorm.DB {
+	query := DB.Model(&ReadCursor{}).Where("read_cursors.conversation_key = ?", conversationKey)
+	if conversationType == MessageTypeGroup {
+		query = query.Joins("JOIN group_members ON group_members.user_id = read_cursors.user_id AND group_members.group_id = ?", groupID)
+	}
+	return query
+}
+
+// GetMessageReaders 获取已读到指定消息的用户（不包括发送者），按已读时间排序
+func GetMessageReaders(message *Message) ([]*ReadCursor, error) {
+	var cursors []*ReadCursor
+	result := readCursorQuery(message.ConversationKey, message.Type, message.GroupID).
+		Where("read_cursors.last_read_message_id >= ? AND read_cursors.user_id <> ?", message.ID, message.SenderID).
+		Select("read_cursors.*").
+		Order("read_cursors.read_at ASC").
+		Find(&cursors)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return cursors, nil
+}
+
+// LoadReadCounts 为群聊消息批量填充已读人数
+func LoadReadCounts(messages []*Message) error {
+	cursorsByKey := make(map[string][]*ReadCursor)
+	for _, message := range messages {
+		if message.Type != MessageTypeGroup {
+			continue
+		}
+
+		cursors, ok := cursorsByKey[message.ConversationKey]
+		if !ok {
+			err := readCursorQuery(message.ConversationKey, message.Type, message.GroupID).
+				Select("read_cursors.*").
+				Find(&cursors).Error
+			if err != nil {
+				return err
+			}
+			cursorsByKey[message.ConversationKey] = cursors
+		}
+
+		message.ReadCount = 0
+		for _, cursor := range cursors {
+			if cursor.UserID != message.SenderID && cursor.LastReadMessageID >= message.ID {
+				message.ReadCount++
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fullTextIndexName 消息内容的全文索引名称
+const fullTextIndexName = "idx_messages_content_fulltext"
+
+// MessageSearchFilter 消息搜索的过滤条件
+type MessageSearchFilter struct {
+	ConversationKeys []string  // 允许搜索的会话，为空时不返回任何结果
+	SenderID         uint      // 发送者ID，0表示不限
+	Since            time.Time // 不早于该时间，零值表示不限
+	Until            time.Time // 早于该时间，零值表示不限
+	BeforeID         uint      // 分页游标，获取ID小于该值的消息
+	ViewerID         uint      // 搜索者ID，用于过滤其"仅对自己删除"的消息
+	Limit            int
+}
+
+// IsSearchable 消息是否应该出现在搜索结果中，已撤回的消息和系统通知不参与搜索
+func (m *Message) IsSearchable() bool {
+	return !m.Recalled && m.Kind != MessageKindSystem && m.Content != ""
+}
+
+// CreateFullTextIndex 为消息内容创建使用ngram分词的全文索引，ngram分词支持中文等没有空格分隔的语言
+func CreateFullTextIndex() error {
+	if DB.Migrator().HasIndex("messages", fullTextIndexName) {
+		return nil
+	}
+	return DB.Exec("CREATE FULLTEXT INDEX " + fullTextIndexName + " ON messages (content) WITH PARSER ngram").Error
+}
+
+// SearchMessageIDs 使用全文索引搜索消息，按ID降序返回。
+// match为BOOLEAN MODE的查询表达式，substrings为需要额外用LIKE匹配的片段（短于ngram长度的词）
+func SearchMessageIDs(filter MessageSearchFilter, match string, substrings []string) ([]uint, error) {
+	ids := make([]uint, 0)
+	if len(filter.ConversationKeys) == 0 {
+		return ids, nil
+	}
+
+	query := DB.Model(&Message{}).
+		Where("conversation_key IN ? AND recalled = ? AND kind <> ?", filter.ConversationKeys, false, MessageKindSystem).
+		Where("NOT EXISTS (SELECT 1 FROM message_hiddens WHERE message_hiddens.message_id = messages.id AND message_hiddens.user_id = ?)", filter.ViewerID)
+	if match != "" {
+		query = query.Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", match)
+	}
+	for _, s := range substrings {
+		query = query.Where("content LIKE ?", "%"+escapeLike(s)+"%")
+	}
+	query = applySearchFilter(query, filter)
+
+	err := query.Order("id DESC").Limit(filter.Limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetSearchableMessages 从新到旧分批获取可以被搜索的消息，用于重建索引。beforeID为0时从最新的消息开始
+func GetSearchableMessages(beforeID uint, limit int) ([]*Message, error) {
+	var messages []*Message
+	query := DB.Where("recalled = ? AND kind <> ?", false, MessageKindSystem)
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	result := query.Order("id DESC").
+		Limit(limit).
+		Find(&messages)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return messages, nil
+}
+
+// GetSearchableConversationKeys 获取用户当前可以搜索的会话：全部好友的私聊和所在的群聊
+func GetSearchableConversationKeys(userID uint) ([]string, error) {
+	var friendIDs, reverseFriendIDs, groupIDs []uint
+	err := DB.Model(&Friendship{}).
+		Where("user_id = ? AND status = ?", userID, "accepted").
+		Pluck("friend_id", &friendIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(&Friendship{}).
+		Where("friend_id = ? AND status = ?", userID, "accepted").
+		Pluck("user_id", &reverseFriendIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(&GroupMember{}).
+		Where("user_id = ?", userID).
+		Pluck("group_id", &groupIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	keys := make([]string, 0, len(friendIDs)+len(reverseFriendIDs)+len(groupIDs))
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, list := range [][]uint{friendIDs, reverseFriendIDs} {
+		for _, friendID := range list {
+			add(PrivateConversationKey(userID, friendID))
+		}
+	}
+	for _, groupID := range groupIDs {
+		add(GroupConversationKey(groupID))
+	}
+	return keys, nil
+}
+
+// applySearchFilter 添加发送者、时间范围和分页游标条件
+func applySearchFilter(query *gorm.DB, filter MessageSearchFilter) *gorm.DB {
+	if filter.SenderID != 0 {
+		query = query.Where("sender_id = ?", filter.SenderID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("timestamp >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("timestamp < ?", filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	return query
+}
+
+// escapeLike 转义LIKE中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
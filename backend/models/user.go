@@ -6,32 +6,60 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // User MySQL中的用户模型
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"size:50;uniqueIndex;not null" json:"username"`
-	Password  string    `gorm:"size:255;not null" json:"-"`
-	Email     string    `gorm:"size:100;uniqueIndex" json:"email"`
-	Avatar    string    `gorm:"size:255" json:"avatar"`
-	Status    string    `gorm:"size:20;default:'offline'" json:"status"` // online, offline, away
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Username       string         `gorm:"size:50;uniqueIndex;not null" json:"username"`
+	Password       string         `gorm:"size:255;not null" json:"-"`
+	Email          string         `gorm:"size:100;uniqueIndex" json:"email"`
+	Avatar         string         `gorm:"size:255" json:"avatar"`
+	Nickname       string         `gorm:"size:50;index" json:"nickname"`                    // 显示昵称，为空时显示用户名
+	Bio            string         `gorm:"size:500" json:"bio"`                              // 个人简介
+	Gender         string         `gorm:"size:10" json:"gender"`                            // male, female, other，为空表示未设置
+	Birthday       string         `gorm:"size:10" json:"birthday"`                          // 生日，格式为YYYY-MM-DD
+	Region         string         `gorm:"size:100" json:"region"`                           // 地区
+	Signature      string         `gorm:"size:100" json:"signature"`                        // 个性签名
+	FindByUsername string         `gorm:"size:20;default:'everyone'" json:"findByUsername"` // 谁可以通过用户名或昵称搜索到自己，见Privacy常量
+	FindByEmail    string         `gorm:"size:20;default:'nobody'" json:"findByEmail"`      // 谁可以通过邮箱搜索到自己
+	Status         string         `gorm:"size:20;default:'offline'" json:"status"`          // online, offline, away，由WebSocket连接维护
+	LastSeenAt     *time.Time     `json:"lastSeenAt,omitempty"`                             // 最后一次在线活动的时间
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // Friendship MySQL中的好友关系模型
 type Friendship struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"not null;index" json:"userId"`
-	FriendID  uint      `gorm:"not null;index" json:"friendId"`
-	Status    string    `gorm:"size:20;default:'pending'" json:"status"` // pending, accepted, rejected
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"not null;index" json:"userId"`
+	FriendID  uint           `gorm:"not null;index" json:"friendId"`
+	Status    string         `gorm:"size:20;default:'pending'" json:"status"` // pending, accepted, rejected, expired
+	Greeting  string         `gorm:"size:200" json:"greeting,omitempty"`      // 好友请求的附言
+	ExpiresAt *time.Time     `json:"expiresAt,omitempty"`                     // 好友请求的过期时间
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// 性别的可选值，空字符串表示未设置
+const (
+	GenderMale   = "male"
+	GenderFemale = "female"
+	GenderOther  = "other"
+)
+
+// ValidGender 是否为有效的性别
+func ValidGender(value string) bool {
+	switch value {
+	case "", GenderMale, GenderFemale, GenderOther:
+		return true
+	}
+	return false
+}
+
 // CheckPassword 检查密码是否正确
 func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
@@ -65,10 +93,12 @@ func CreateUser(username, password, email string) (*User, error) {
 
 	// 创建用户
 	user := &User{
-		Username: username,
-		Password: string(hashedPassword),
-		Email:    email,
-		Status:   "offline",
+		Username:       username,
+		Password:       string(hashedPassword),
+		Email:          email,
+		Status:         "offline",
+		FindByUsername: PrivacyEveryone,
+		FindByEmail:    PrivacyNobody,
 	}
 
 	result = DB.Create(user)
@@ -99,14 +129,87 @@ func GetUserByID(id uint) (*User, error) {
 	return &user, nil
 }
 
-// UpdateUser 更新用户信息
+// GetUsersByIDs 根据ID批量获取用户
+func GetUsersByIDs(ids []uint) ([]*User, error) {
+	var users []*User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	result := DB.Where("id IN ?", ids).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// UpdatePresence 更新用户的在线状态和最后在线时间
+func UpdatePresence(userID uint, status string, lastSeenAt time.Time) error {
+	result := DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"status":       status,
+		"last_seen_at": lastSeenAt,
+	})
+	return result.Error
+}
+
+// UpdateUserAvatar 更新用户头像地址
+func UpdateUserAvatar(userID uint, avatar string) error {
+	result := DB.Model(&User{}).Where("id = ?", userID).Update("avatar", avatar)
+	return result.Error
+}
+
+// ResetPresence 将所有用户标记为离线，服务启动时调用，清除上次运行遗留的在线状态
+func ResetPresence() error {
+	result := DB.Model(&User{}).Where("status <> ?", "offline").Update("status", "offline")
+	return result.Error
+}
+
+// GetRelatedUserIDs 获取用户的全部好友和同群成员，不包括用户自己
+func GetRelatedUserIDs(userID uint) ([]uint, error) {
+	var friendIDs, reverseFriendIDs, memberIDs []uint
+	err := DB.Model(&Friendship{}).
+		Where("user_id = ? AND status = ?", userID, "accepted").
+		Pluck("friend_id", &friendIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(&Friendship{}).
+		Where("friend_id = ? AND status = ?", userID, "accepted").
+		Pluck("user_id", &reverseFriendIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Table("group_members AS others").
+		Joins("JOIN group_members AS mine ON mine.group_id = others.group_id").
+		Where("mine.user_id = ? AND others.user_id <> ?", userID, userID).
+		Distinct().
+		Pluck("others.user_id", &memberIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool)
+	userIDs := make([]uint, 0, len(friendIDs)+len(reverseFriendIDs)+len(memberIDs))
+	for _, list := range [][]uint{friendIDs, reverseFriendIDs, memberIDs} {
+		for _, id := range list {
+			if id != userID && !seen[id] {
+				seen[id] = true
+				userIDs = append(userIDs, id)
+			}
+		}
+	}
+	return userIDs, nil
+}
+
+// UpdateUser 更新用户信息，在线状态由UpdatePresence单独维护，这里不会覆盖
 func UpdateUser(user *User) error {
-	result := DB.Save(user)
+	result := DB.Omit("status", "last_seen_at").Save(user)
 	return result.Error
 }
 
-// AddFriend 添加好友请求
-func AddFriend(userID, friendID uint) (*Friendship, error) {
+// AddFriend 向friendID发送好友请求，返回新建的请求。
+// 对方已经向自己发出未过期的请求时直接成为好友，返回的关系状态为accepted；
+// 之前被拒绝或已过期的请求会被新的请求替换，自己的请求被拒绝后cooldown内再次发送返回ErrFriendRequestCooldown
+func AddFriend(userID, friendID uint, greeting string, ttl, cooldown time.Duration) (*Friendship, error) {
 	// 检查用户和好友是否存在
 	_, err := GetUserByID(userID)
 	if err != nil {
@@ -118,27 +221,60 @@ func AddFriend(userID, friendID uint) (*Friendship, error) {
 		return nil, errors.New("好友不存在")
 	}
 
-	// 检查是否已经是好友
-	var existingFriendship Friendship
-	result := DB.Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)", 
-		userID, friendID, friendID, userID).First(&existingFriendship)
-	
-	if result.Error == nil {
-		return nil, errors.New("好友关系已存在")
-	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return nil, result.Error
-	}
+	var friendship *Friendship
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		// 按ID顺序锁住双方的用户记录，同一对用户的并发请求依次执行，不会同时创建两条请求
+		first, second := userID, friendID
+		if first > second {
+			first, second = second, first
+		}
+		for _, id := range []uint{first, second} {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&User{}, id).Error; err != nil {
+				return err
+			}
+		}
 
-	// 创建好友关系
-	friendship := &Friendship{
-		UserID:   userID,
-		FriendID: friendID,
-		Status:   "pending",
-	}
+		var existing Friendship
+		result := tx.Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
+			userID, friendID, friendID, userID).First(&existing)
 
-	result = DB.Create(friendship)
-	if result.Error != nil {
-		return nil, result.Error
+		if result.Error == nil {
+			switch {
+			case existing.Status == FriendshipAccepted:
+				return ErrAlreadyFriends
+			case existing.IsPendingRequest():
+				if existing.UserID == userID {
+					return ErrFriendRequestPending
+				}
+				// 双方互相发送请求，视为接受对方的请求
+				existing.Status = FriendshipAccepted
+				existing.ExpiresAt = nil
+				friendship = &existing
+				return tx.Save(friendship).Error
+			case existing.Status == FriendshipRejected && existing.UserID == userID &&
+				time.Since(existing.UpdatedAt) < cooldown:
+				return ErrFriendRequestCooldown
+			}
+			if err := tx.Delete(&existing).Error; err != nil {
+				return err
+			}
+		} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		// 创建好友请求
+		expiresAt := time.Now().Add(ttl)
+		friendship = &Friendship{
+			UserID:    userID,
+			FriendID:  friendID,
+			Status:    FriendshipPending,
+			Greeting:  greeting,
+			ExpiresAt: &expiresAt,
+		}
+		return tx.Create(friendship).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return friendship, nil
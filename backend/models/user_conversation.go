@@ -0,0 +1,241 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserConversation 用户的会话列表摘要，随消息的发送和已读增量维护，避免每次查询时扫描消息表
+type UserConversation struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"not null;uniqueIndex:idx_user_conversation" json:"userId"`
+	ConversationKey string     `gorm:"size:50;not null;uniqueIndex:idx_user_conversation;index" json:"conversationKey"`
+	Type            string     `gorm:"size:20;not null" json:"type"` // private, group
+	UnreadCount     int        `gorm:"not null;default:0" json:"unreadCount"`
+	Muted           bool       `gorm:"default:false" json:"muted"`
+	Pinned          bool       `gorm:"default:false" json:"pinned"`
+	PinnedAt        *time.Time `json:"pinnedAt,omitempty"`
+	LastMessageAt   *time.Time `json:"lastMessageAt,omitempty"` // 会话最后一条主时间线消息的时间
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// conversationParticipantIDs 在事务中获取会话的全部参与者
+func conversationParticipantIDs(tx *gorm.DB, message *Message) ([]uint, error) {
+	if message.Type != MessageTypeGroup {
+		return []uint{message.SenderID, message.ReceiverID}, nil
+	}
+
+	var memberIDs []uint
+	err := tx.Model(&GroupMember{}).Where("group_id = ?", message.GroupID).Pluck("user_id", &memberIDs).Error
+	return memberIDs, err
+}
+
+// touchConversation 在事务中更新会话的最后一条消息，并为其他参与者增加未读数
+// 只统计主时间线消息，话题回复不影响会话列表。shadowedIDs为看不到该消息的参与者，不更新他们的会话摘要
+func touchConversation(tx *gorm.DB, message *Message, shadowedIDs ...uint) error {
+	err := tx.Model(&Conversation{}).
+		Where("conversation_key = ?", message.ConversationKey).
+		Updates(map[string]interface{}{
+			"last_message_id": message.ID,
+			"last_message_at": message.Timestamp,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	participantIDs, err := conversationParticipantIDs(tx, message)
+	if err != nil {
+		return err
+	}
+	participantIDs = excludeUserIDs(participantIDs, shadowedIDs)
+	if len(participantIDs) == 0 {
+		return nil
+	}
+
+	rows := make([]*UserConversation, 0, len(participantIDs))
+	for _, participantID := range participantIDs {
+		rows = append(rows, &UserConversation{
+			UserID:          participantID,
+			ConversationKey: message.ConversationKey,
+			Type:            message.Type,
+		})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+		return err
+	}
+
+	err = tx.Model(&UserConversation{}).
+		Where("conversation_key = ? AND user_id IN ?", message.ConversationKey, participantIDs).
+		Updates(map[string]interface{}{
+			"last_message_at": message.Timestamp,
+			"unread_count":    gorm.Expr("CASE WHEN user_id = ? THEN unread_count ELSE unread_count + 1 END", message.SenderID),
+		}).Error
+	return err
+}
+
+// excludeUserIDs 从userIDs中去掉excluded中的用户
+func excludeUserIDs(userIDs, excluded []uint) []uint {
+	if len(excluded) == 0 {
+		return userIDs
+	}
+	skip := make(map[uint]bool, len(excluded))
+	for _, id := range excluded {
+		skip[id] = true
+	}
+	result := make([]uint, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !skip[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// refreshUnreadCount 在事务中按已读位置重新计算用户在会话中的未读数，不计入已撤回和对该用户隐藏的消息
+func refreshUnreadCount(tx *gorm.DB, conversationKey string, userID, lastReadMessageID uint) error {
+	var unread int64
+	err := tx.Model(&Message{}).
+		Where("conversation_key = ? AND id > ? AND sender_id <> ? AND thread_root_id IS NULL AND recalled = ?", conversationKey, lastReadMessageID, userID, false).
+		Where("NOT EXISTS (SELECT 1 FROM message_hiddens WHERE message_hiddens.message_id = messages.id AND message_hiddens.user_id = ?)", userID).
+		Count(&unread).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&UserConversation{}).
+		Where("conversation_key = ? AND user_id = ?", conversationKey, userID).
+		Update("unread_count", unread).Error
+}
+
+// GetUserConversations 获取用户全部的会话摘要，以会话标识为键
+func GetUserConversations(userID uint) (map[string]*UserConversation, error) {
+	var list []*UserConversation
+	if err := DB.Where("user_id = ?", userID).Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	conversations := make(map[string]*UserConversation, len(list))
+	for _, conversation := range list {
+		conversations[conversation.ConversationKey] = conversation
+	}
+	return conversations, nil
+}
+
+// GetConversationsByKeys 批量获取会话，以会话标识为键
+func GetConversationsByKeys(conversationKeys []string) (map[string]*Conversation, error) {
+	conversations := make(map[string]*Conversation, len(conversationKeys))
+	if len(conversationKeys) == 0 {
+		return conversations, nil
+	}
+
+	var list []*Conversation
+	if err := DB.Where("conversation_key IN ?", conversationKeys).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, conversation := range list {
+		conversations[conversation.ConversationKey] = conversation
+	}
+	return conversations, nil
+}
+
+// GetLastVisibleMessageIDs 获取会话中对用户可见的最后一条主时间线消息，以会话标识为键。
+// 用于会话的最后一条消息被该用户删除或对其隐藏时，找到该用户能看到的上一条消息
+func GetLastVisibleMessageIDs(userID uint, conversationKeys []string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(conversationKeys))
+	if len(conversationKeys) == 0 {
+		return ids, nil
+	}
+
+	var rows []struct {
+		ConversationKey string
+		LastID          uint
+	}
+	err := DB.Model(&Message{}).
+		Select("conversation_key, MAX(id) AS last_id").
+		Where("conversation_key IN ? AND thread_root_id IS NULL", conversationKeys).
+		Where("NOT EXISTS (SELECT 1 FROM message_hiddens WHERE message_hiddens.message_id = messages.id AND message_hiddens.user_id = ?)", userID).
+		Group("conversation_key").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ids[row.ConversationKey] = row.LastID
+	}
+	return ids, nil
+}
+
+// UpdateConversationSettings 更新用户的会话免打扰和置顶设置，为nil的设置保持不变
+func UpdateConversationSettings(userID uint, conversationKey, conversationType string, muted, pinned *bool) (*UserConversation, error) {
+	var conversation UserConversation
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserConversation{
+			UserID:          userID,
+			ConversationKey: conversationKey,
+			Type:            conversationType,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		updates := make(map[string]interface{})
+		if muted != nil {
+			updates["muted"] = *muted
+		}
+		if pinned != nil {
+			updates["pinned"] = *pinned
+			if *pinned {
+				updates["pinned_at"] = time.Now()
+			} else {
+				updates["pinned_at"] = nil
+			}
+		}
+
+		query := tx.Model(&UserConversation{}).Where("user_id = ? AND conversation_key = ?", userID, conversationKey)
+		if len(updates) > 0 {
+			if err := query.Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("user_id = ? AND conversation_key = ?", userID, conversationKey).First(&conversation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// backfillLastMessages 为迁移前已有消息的会话补齐最后一条消息，旧消息视为已读
+func backfillLastMessages() error {
+	var conversations []*Conversation
+	if err := DB.Where("last_message_id = ?", 0).Find(&conversations).Error; err != nil {
+		return err
+	}
+
+	for _, conversation := range conversations {
+		var last Message
+		result := DB.Where("conversation_key = ? AND thread_root_id IS NULL", conversation.ConversationKey).
+			Order("id DESC").
+			Limit(1).
+			Find(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		err := DB.Model(conversation).Updates(map[string]interface{}{
+			"last_message_id": last.ID,
+			"last_message_at": last.Timestamp,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
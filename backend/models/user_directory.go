@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm/clause"
+)
+
+// userFullTextIndexName 用户名和昵称的全文索引名称
+const userFullTextIndexName = "idx_users_name_fulltext"
+
+// userNgramTokenSize ngram分词的长度，短于该长度的关键词只做前缀匹配
+const userNgramTokenSize = 2
+
+// 隐私设置的可选值，表示谁可以搜索到自己
+const (
+	PrivacyEveryone = "everyone" // 所有人
+	PrivacyContacts = "contacts" // 好友和同群成员
+	PrivacyNobody   = "nobody"   // 任何人都不能
+)
+
+// ValidPrivacy 是否为有效的隐私设置
+func ValidPrivacy(value string) bool {
+	switch value {
+	case PrivacyEveryone, PrivacyContacts, PrivacyNobody:
+		return true
+	}
+	return false
+}
+
+// AllowsFinder 按隐私设置判断viewer能否找到用户，isContact表示双方是否为好友或同群成员
+func AllowsFinder(setting string, isContact bool) bool {
+	return setting == PrivacyEveryone || (setting == PrivacyContacts && isContact)
+}
+
+// createUserFullTextIndex 为用户名和昵称创建使用ngram分词的全文索引，用于按关键词片段搜索用户
+func createUserFullTextIndex() error {
+	if DB.Migrator().HasIndex("users", userFullTextIndexName) {
+		return nil
+	}
+	return DB.Exec("CREATE FULLTEXT INDEX " + userFullTextIndexName + " ON users (username, nickname) WITH PARSER ngram").Error
+}
+
+// SearchUsers 按用户名和昵称搜索用户，完全匹配的排在最前，其次是前缀匹配，最后是包含关键词的。
+// 关键词短于ngram长度时只按索引做前缀匹配，否则使用全文索引匹配包含关键词的用户，都不需要扫描整张表。
+// 只返回隐私设置允许viewer搜索、且没有屏蔽viewer的用户，contactIDs为viewer的好友和同群成员
+func SearchUsers(viewerID uint, keyword string, contactIDs []uint, offset, limit int) ([]*User, error) {
+	pattern := escapeLike(keyword)
+	query := DB.Where("id <> ?", viewerID)
+	if utf8.RuneCountInString(keyword) < userNgramTokenSize {
+		query = query.Where("username LIKE ? OR nickname LIKE ?", pattern+"%", pattern+"%")
+	} else {
+		// 作为短语匹配，要求关键词的各个分词连续出现；双引号会结束短语，需要去掉
+		phrase := `"` + strings.ReplaceAll(keyword, `"`, " ") + `"`
+		query = query.Where("MATCH(username, nickname) AGAINST(? IN BOOLEAN MODE)", phrase)
+	}
+	query = query.
+		Where("NOT EXISTS (SELECT 1 FROM user_blocks WHERE user_blocks.user_id = users.id AND user_blocks.blocked_id = ?)", viewerID)
+	if len(contactIDs) > 0 {
+		query = query.Where("find_by_username = ? OR (find_by_username = ? AND id IN ?)", PrivacyEveryone, PrivacyContacts, contactIDs)
+	} else {
+		query = query.Where("find_by_username = ?", PrivacyEveryone)
+	}
+
+	var users []*User
+	result := query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "CASE WHEN username = ? OR nickname = ? THEN 0 WHEN username LIKE ? OR nickname LIKE ? THEN 1 ELSE 2 END, username",
+		Vars:               []interface{}{keyword, keyword, pattern + "%", pattern + "%"},
+		WithoutParentheses: true,
+	}}).
+		Offset(offset).
+		Limit(limit).
+		Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// GetUserByEmail 根据邮箱获取用户
+func GetUserByEmail(email string) (*User, error) {
+	var user User
+	result := DB.Where("email = ?", email).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// UpdateUserPrivacy 更新用户的隐私设置
+func UpdateUserPrivacy(userID uint, findByUsername, findByEmail string) error {
+	result := DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"find_by_username": findByUsername,
+		"find_by_email":    findByEmail,
+	})
+	return result.Error
+}
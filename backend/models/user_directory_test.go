@@ -0,0 +1,24 @@
+package models
+
+import "testing"
+
+func TestAllowsFinder(t *testing.T) {
+	tests := []struct {
+		setting   string
+		isContact bool
+		want      bool
+	}{
+		{PrivacyEveryone, false, true},
+		{PrivacyEveryone, true, true},
+		{PrivacyContacts, false, false},
+		{PrivacyContacts, true, true},
+		{PrivacyNobody, false, false},
+		{PrivacyNobody, true, false},
+		{"", true, false},
+	}
+	for _, tt := range tests {
+		if got := AllowsFinder(tt.setting, tt.isContact); got != tt.want {
+			t.Errorf("AllowsFinder(%q, %v) = %v, want %v", tt.setting, tt.isContact, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// 高亮片段的参数
+const (
+	maxFragments    = 3  // 最多返回的片段数
+	fragmentContext = 20 // 匹配位置前后保留的字符数
+	highlightStart  = "<em>"
+	highlightEnd    = "</em>"
+)
+
+// Highlight 截取消息内容中匹配关键词的片段，匹配部分用<em>标记，其余内容做HTML转义。
+// 没有找到匹配位置时返回内容开头的片段
+func Highlight(content, keyword string) []string {
+	original := []rune(content)
+	lowered := []rune(lower(content))
+
+	// 找出全部匹配区间并按位置合并
+	var spans [][2]int
+	for _, term := range Terms(keyword) {
+		needle := []rune(term)
+		for i := 0; i+len(needle) <= len(lowered); i++ {
+			if string(lowered[i:i+len(needle)]) == term {
+				spans = append(spans, [2]int{i, i + len(needle)})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		end := 2 * fragmentContext
+		if end > len(original) {
+			end = len(original)
+		}
+		return []string{fragment(original, 0, end, nil)}
+	}
+	spans = mergeSpans(spans)
+
+	// 上下文相互重叠的匹配合并为一个片段
+	fragments := make([]string, 0, maxFragments)
+	for i := 0; i < len(spans) && len(fragments) < maxFragments; {
+		start := spans[i][0] - fragmentContext
+		if start < 0 {
+			start = 0
+		}
+		j := i + 1
+		for j < len(spans) && spans[j][0]-fragmentContext <= spans[j-1][1]+fragmentContext {
+			j++
+		}
+		end := spans[j-1][1] + fragmentContext
+		if end > len(original) {
+			end = len(original)
+		}
+		fragments = append(fragments, fragment(original, start, end, spans[i:j]))
+		i = j
+	}
+	return fragments
+}
+
+// mergeSpans 按起始位置排序并合并重叠的区间
+func mergeSpans(spans [][2]int) [][2]int {
+	for i := 1; i < len(spans); i++ {
+		for j := i; j > 0 && spans[j][0] < spans[j-1][0]; j-- {
+			spans[j], spans[j-1] = spans[j-1], spans[j]
+		}
+	}
+	merged := [][2]int{spans[0]}
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span[0] <= last[1] {
+			if span[1] > last[1] {
+				last[1] = span[1]
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// fragment 生成[start, end)范围内的片段，被截断的一侧加省略号
+func fragment(text []rune, start, end int, spans [][2]int) string {
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, span := range spans {
+		b.WriteString(html.EscapeString(string(text[pos:span[0]])))
+		b.WriteString(highlightStart)
+		b.WriteString(html.EscapeString(string(text[span[0]:span[1]])))
+		b.WriteString(highlightEnd)
+		pos = span[1]
+	}
+	b.WriteString(html.EscapeString(string(text[pos:end])))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    []string
+	}{
+		{"", []string{}},
+		{"  Hello  World ", []string{"hello", "world"}},
+		{"go GO go", []string{"go"}},
+		{`"quoted" ""`, []string{"quoted"}},
+		{"a b c d e f g", []string{"a", "b", "c", "d", "e"}},
+		{"明天 开会", []string{"明天", "开会"}},
+	}
+	for _, tt := range tests {
+		if got := Terms(tt.keyword); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Terms(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("x", 30)
+
+	tests := []struct {
+		name    string
+		content string
+		keyword string
+		want    []string
+	}{
+		{"single match", "hello world", "world", []string{"hello <em>world</em>"}},
+		{"case insensitive", "Hello World", "hello", []string{"<em>Hello</em> World"}},
+		{"escapes html", "<b>hi</b>", "hi", []string{"&lt;b&gt;<em>hi</em>&lt;/b&gt;"}},
+		{"overlapping terms merged", "abcdef", "abc cde", []string{"<em>abcde</em>f"}},
+		{"chinese", "明天下午开会", "开会", []string{"明天下午<em>开会</em>"}},
+		{"no match", "hello", "xyz", []string{"hello"}},
+		{
+			"context truncated",
+			long + "key" + long,
+			"key",
+			[]string{"…" + long[:fragmentContext] + "<em>key</em>" + long[:fragmentContext] + "…"},
+		},
+		{
+			"distant matches split",
+			"a" + long + long + "a",
+			"a",
+			[]string{"<em>a</em>" + long[:fragmentContext] + "…", "…" + long[:fragmentContext] + "<em>a</em>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.content, tt.keyword); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Highlight(%q, %q) = %q, want %q", tt.content, tt.keyword, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package search
+
+import (
+	"container/heap"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// rebuildBatchSize 重建索引时每批读取的消息数
+const rebuildBatchSize = 1000
+
+// memoryDoc 内存索引中的一条消息
+type memoryDoc struct {
+	conversationKey string
+	senderID        uint
+	timestamp       time.Time
+	content         string   // 小写的消息内容，用于确认关键词连续出现
+	grams           []string // 消息内容的全部分词
+}
+
+// memoryIndexer 进程内的倒排索引，只用于开发和测试环境（如使用SQLite时）。
+// 与ngram分词相同，连续的文字按单字和相邻两字切分，不依赖空格，可以搜索中文。
+// 索引只保存在内存中，启动时从数据库重建；最多保存maxDocs条消息，超出后淘汰最早的消息，
+// 因此只能搜索到最近的消息
+type memoryIndexer struct {
+	mu       sync.RWMutex
+	maxDocs  int
+	docs     map[uint]*memoryDoc
+	postings map[string]map[uint]struct{}
+	order    idHeap // 全部已索引消息的ID，用于淘汰最早的消息；被删除的ID在出堆时跳过
+	// truncated 是否有较早的消息因为数量上限没有加载或已被淘汰
+	truncated bool
+}
+
+// NewMemoryIndexer 创建内存索引，并从数据库加载最近的maxDocs条可以搜索的消息
+func NewMemoryIndexer(maxDocs int) (Indexer, error) {
+	idx := newMemoryIndexer(maxDocs)
+
+	var beforeID uint
+	for len(idx.docs) < maxDocs {
+		messages, err := models.GetSearchableMessages(beforeID, rebuildBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			if message.IsSearchable() && len(idx.docs) < maxDocs {
+				idx.add(message)
+			}
+			beforeID = message.ID
+		}
+		if len(messages) < rebuildBatchSize {
+			break
+		}
+	}
+	// 达到上限时可能还有更早的消息没有加载
+	idx.truncated = len(idx.docs) >= maxDocs
+	log.Printf("消息搜索索引加载完成，共%d条消息", len(idx.docs))
+	return idx, nil
+}
+
+// newMemoryIndexer 创建空的内存索引
+func newMemoryIndexer(maxDocs int) *memoryIndexer {
+	return &memoryIndexer{
+		maxDocs:  maxDocs,
+		docs:     make(map[uint]*memoryDoc),
+		postings: make(map[string]map[uint]struct{}),
+	}
+}
+
+// Truncated 是否有较早的消息因为数量上限不在索引中
+func (m *memoryIndexer) Truncated() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.truncated
+}
+
+// Index 写入或更新消息的索引
+func (m *memoryIndexer) Index(message *models.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(message.ID)
+	if message.IsSearchable() {
+		m.add(message)
+		m.evict()
+	}
+	return nil
+}
+
+// Remove 从索引中删除消息
+func (m *memoryIndexer) Remove(messageID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(messageID)
+	return nil
+}
+
+// RemoveConversation 删除会话的全部消息
+func (m *memoryIndexer) RemoveConversation(conversationKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, doc := range m.docs {
+		if doc.conversationKey == conversationKey {
+			m.remove(id)
+		}
+	}
+	return nil
+}
+
+// Search 用分词求出候选消息，再确认每个关键词在内容中连续出现
+func (m *memoryIndexer) Search(query Query) ([]uint, error) {
+	terms := Terms(query.Keyword)
+	if len(terms) == 0 || len(query.ConversationKeys) == 0 {
+		return []uint{}, nil
+	}
+	allowed := make(map[string]bool, len(query.ConversationKeys))
+	for _, key := range query.ConversationKeys {
+		allowed[key] = true
+	}
+
+	var grams []string
+	for _, term := range terms {
+		grams = append(grams, queryGrams(term)...)
+	}
+	// 关键词全是标点时没有可以查询的分词，不扫描全部消息
+	if len(grams) == 0 {
+		return []uint{}, nil
+	}
+
+	m.mu.RLock()
+	candidates := m.match(grams, func(id uint, doc *memoryDoc) bool {
+		if !allowed[doc.conversationKey] {
+			return false
+		}
+		if query.SenderID != 0 && doc.senderID != query.SenderID {
+			return false
+		}
+		if !query.Since.IsZero() && doc.timestamp.Before(query.Since) {
+			return false
+		}
+		if !query.Until.IsZero() && !doc.timestamp.Before(query.Until) {
+			return false
+		}
+		if query.BeforeID != 0 && id >= query.BeforeID {
+			return false
+		}
+		for _, term := range terms {
+			if !strings.Contains(doc.content, term) {
+				return false
+			}
+		}
+		return true
+	})
+	m.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] > candidates[j] })
+	return filterHidden(candidates, query.ViewerID, query.Limit)
+}
+
+// match 返回包含全部分词且满足accept的消息ID，grams不能为空
+func (m *memoryIndexer) match(grams []string, accept func(uint, *memoryDoc) bool) []uint {
+	ids := make([]uint, 0)
+	// 从最短的倒排列表开始，逐个检查其余分词
+	smallest := m.postings[grams[0]]
+	for _, gram := range grams[1:] {
+		if len(m.postings[gram]) < len(smallest) {
+			smallest = m.postings[gram]
+		}
+	}
+	for id := range smallest {
+		ok := true
+		for _, gram := range grams {
+			if _, found := m.postings[gram][id]; !found {
+				ok = false
+				break
+			}
+		}
+		if ok && accept(id, m.docs[id]) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// add 将消息加入索引，调用方需持有写锁
+func (m *memoryIndexer) add(message *models.Message) {
+	content := lower(message.Content)
+	heap.Push(&m.order, message.ID)
+	doc := &memoryDoc{
+		conversationKey: message.ConversationKey,
+		senderID:        message.SenderID,
+		timestamp:       message.Timestamp,
+		content:         content,
+		grams:           indexGrams(content),
+	}
+	m.docs[message.ID] = doc
+	for _, gram := range doc.grams {
+		posting, ok := m.postings[gram]
+		if !ok {
+			posting = make(map[uint]struct{})
+			m.postings[gram] = posting
+		}
+		posting[message.ID] = struct{}{}
+	}
+}
+
+// remove 将消息移出索引，调用方需持有写锁
+func (m *memoryIndexer) remove(messageID uint) {
+	doc, ok := m.docs[messageID]
+	if !ok {
+		return
+	}
+	for _, gram := range doc.grams {
+		posting := m.postings[gram]
+		delete(posting, messageID)
+		if len(posting) == 0 {
+			delete(m.postings, gram)
+		}
+	}
+	delete(m.docs, messageID)
+}
+
+// evict 超出maxDocs时淘汰最早的消息，调用方需持有写锁
+func (m *memoryIndexer) evict() {
+	for len(m.docs) > m.maxDocs && m.order.Len() > 0 {
+		id := heap.Pop(&m.order).(uint)
+		if _, ok := m.docs[id]; ok {
+			m.remove(id)
+			m.truncated = true
+		}
+	}
+	// 被删除的消息仍留在堆中，堆过大时重建
+	if m.order.Len() > 2*len(m.docs)+rebuildBatchSize {
+		m.order = m.order[:0]
+		for id := range m.docs {
+			m.order = append(m.order, id)
+		}
+		heap.Init(&m.order)
+	}
+}
+
+// idHeap 消息ID的最小堆
+type idHeap []uint
+
+func (h idHeap) Len() int            { return len(h) }
+func (h idHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h idHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *idHeap) Push(x interface{}) { *h = append(*h, x.(uint)) }
+func (h *idHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// filterHidden 按顺序过滤掉对搜索者隐藏的消息，直到取满limit条
+func filterHidden(ids []uint, viewerID uint, limit int) ([]uint, error) {
+	result := make([]uint, 0, limit)
+	for start := 0; start < len(ids) && len(result) < limit; start += limit {
+		end := start + limit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		hidden, err := models.GetHiddenMessageIDs(viewerID, ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids[start:end] {
+			if !hidden[id] && len(result) < limit {
+				result = append(result, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// indexGrams 将内容中连续的文字切分为单字和相邻两字，去掉重复
+func indexGrams(content string) []string {
+	seen := make(map[string]bool)
+	grams := make([]string, 0)
+	for _, run := range wordRuns(content) {
+		for i := range run {
+			for n := 1; n <= 2 && i+n <= len(run); n++ {
+				gram := string(run[i : i+n])
+				if !seen[gram] {
+					seen[gram] = true
+					grams = append(grams, gram)
+				}
+			}
+		}
+	}
+	return grams
+}
+
+// queryGrams 关键词的分词：单个字时使用单字，否则使用相邻两字
+func queryGrams(term string) []string {
+	grams := make([]string, 0)
+	for _, run := range wordRuns(term) {
+		if len(run) == 1 {
+			grams = append(grams, string(run))
+			continue
+		}
+		for i := 0; i+2 <= len(run); i++ {
+			grams = append(grams, string(run[i:i+2]))
+		}
+	}
+	return grams
+}
+
+// wordRuns 按标点和空白切分出连续的文字和数字
+func wordRuns(s string) [][]rune {
+	runs := make([][]rune, 0)
+	var current []rune
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			current = append(current, r)
+			continue
+		}
+		if len(current) > 0 {
+			runs = append(runs, current)
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		runs = append(runs, current)
+	}
+	return runs
+}
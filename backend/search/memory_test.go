@@ -0,0 +1,88 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+func testMessage(id uint, key, content string) *models.Message {
+	return &models.Message{ID: id, ConversationKey: key, Content: content, Kind: models.MessageKindText}
+}
+
+func TestMemoryIndexerEvictsOldest(t *testing.T) {
+	idx := newMemoryIndexer(3)
+	for id := uint(1); id <= 5; id++ {
+		if err := idx.Index(testMessage(id, "g_1", "你好世界")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(idx.docs) != 3 {
+		t.Fatalf("docs = %d, want 3", len(idx.docs))
+	}
+	if !idx.Truncated() {
+		t.Error("index should report truncation after eviction")
+	}
+	for _, id := range []uint{1, 2} {
+		if _, ok := idx.docs[id]; ok {
+			t.Errorf("message %d should be evicted", id)
+		}
+	}
+	// 被淘汰的消息也要从倒排列表中移除
+	if got := len(idx.postings["你好"]); got != 3 {
+		t.Errorf("postings = %d, want 3", got)
+	}
+
+	// 重新索引已有的消息不会重复计数
+	if err := idx.Index(testMessage(5, "g_1", "再见")); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.docs) != 3 {
+		t.Fatalf("docs after update = %d, want 3", len(idx.docs))
+	}
+}
+
+func TestMemoryIndexerRemoveConversation(t *testing.T) {
+	idx := newMemoryIndexer(10)
+	idx.Index(testMessage(1, "g_1", "hello"))
+	idx.Index(testMessage(2, "g_2", "hello"))
+	idx.Index(testMessage(3, "g_1", "world"))
+	if idx.Truncated() {
+		t.Error("index below the limit should not report truncation")
+	}
+
+	if err := idx.RemoveConversation("g_1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.docs) != 1 || idx.docs[2] == nil {
+		t.Fatalf("docs = %v, want only message 2", idx.docs)
+	}
+	if _, ok := idx.postings["wo"]; ok {
+		t.Error("postings of removed conversation should be deleted")
+	}
+}
+
+func TestMemoryIndexerMatch(t *testing.T) {
+	idx := newMemoryIndexer(10)
+	idx.Index(testMessage(1, "g_1", "明天开会"))
+	idx.Index(testMessage(2, "g_1", "今天开会"))
+	idx.Index(testMessage(3, "g_1", "明天见"))
+
+	accept := func(uint, *memoryDoc) bool { return true }
+	tests := []struct {
+		term string
+		want int
+	}{
+		{"明天", 2},
+		{"开会", 2},
+		{"明天开会", 1},
+		{"后天", 0},
+		{"见", 1},
+	}
+	for _, tt := range tests {
+		if got := idx.match(queryGrams(tt.term), accept); len(got) != tt.want {
+			t.Errorf("match(%q) = %v, want %d results", tt.term, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// ngramTokenSize MySQL ngram分词的默认长度（ngram_token_size），短于该长度的词无法通过全文索引匹配
+const ngramTokenSize = 2
+
+// mysqlIndexer 基于MySQL FULLTEXT索引和ngram分词的搜索，索引由数据库随消息写入自动维护
+type mysqlIndexer struct{}
+
+// NewMySQLIndexer 创建MySQL全文搜索，不存在时创建全文索引
+func NewMySQLIndexer() (Indexer, error) {
+	if err := models.CreateFullTextIndex(); err != nil {
+		return nil, err
+	}
+	return &mysqlIndexer{}, nil
+}
+
+// Index 数据库自动维护索引，不需要处理
+func (m *mysqlIndexer) Index(message *models.Message) error {
+	return nil
+}
+
+// Remove 数据库自动维护索引，不需要处理
+func (m *mysqlIndexer) Remove(messageID uint) error {
+	return nil
+}
+
+// RemoveConversation 数据库自动维护索引，不需要处理
+func (m *mysqlIndexer) RemoveConversation(conversationKey string) error {
+	return nil
+}
+
+// Truncated 全文索引覆盖全部消息
+func (m *mysqlIndexer) Truncated() bool {
+	return false
+}
+
+// Search 每个关键词作为必须出现的短语匹配，单个字符的关键词使用LIKE匹配
+func (m *mysqlIndexer) Search(query Query) ([]uint, error) {
+	terms := Terms(query.Keyword)
+	if len(terms) == 0 {
+		return []uint{}, nil
+	}
+
+	phrases := make([]string, 0, len(terms))
+	var substrings []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < ngramTokenSize {
+			substrings = append(substrings, term)
+			continue
+		}
+		phrases = append(phrases, `+"`+term+`"`)
+	}
+	return models.SearchMessageIDs(query.MessageSearchFilter, strings.Join(phrases, " "), substrings)
+}
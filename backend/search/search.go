@@ -0,0 +1,85 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// maxTerms 一次搜索最多使用的关键词数量，多余的关键词被忽略
+const maxTerms = 5
+
+// Query 搜索条件，关键词按空白分隔，消息需要包含全部关键词
+type Query struct {
+	Keyword string
+	models.MessageSearchFilter
+}
+
+// Indexer 消息全文索引
+type Indexer interface {
+	// Index 写入或更新消息的索引，不可搜索的消息（已撤回、系统通知）从索引中删除
+	Index(message *models.Message) error
+	// Remove 从索引中删除消息
+	Remove(messageID uint) error
+	// RemoveConversation 删除会话的全部消息，例如群组解散后
+	RemoveConversation(conversationKey string) error
+	// Search 搜索消息，按ID降序返回至多Limit条消息ID，结果只包含ConversationKeys中的会话
+	Search(query Query) ([]uint, error)
+	// Truncated 索引是否缺少较早的消息，为true时搜索不到早于索引范围的消息
+	Truncated() bool
+}
+
+// Engine 全局搜索实例
+var Engine Indexer
+
+// InitSearch 根据配置初始化消息搜索
+func InitSearch() {
+	var err error
+	Engine, err = New()
+	if err != nil {
+		log.Fatalf("初始化消息搜索失败: %v", err)
+	}
+	log.Printf("消息搜索初始化完成: %s", config.AppConfig.Search.Driver)
+}
+
+// New 根据配置创建搜索实现
+func New() (Indexer, error) {
+	switch config.AppConfig.Search.Driver {
+	case "mysql", "":
+		return NewMySQLIndexer()
+	case "memory":
+		if config.AppConfig.Server.Mode == "production" {
+			log.Printf("警告: memory搜索只用于开发环境，索引不持久化且只保存最近的%d条消息", config.AppConfig.Search.MemoryMaxDocs)
+		}
+		return NewMemoryIndexer(config.AppConfig.Search.MemoryMaxDocs)
+	default:
+		return nil, fmt.Errorf("不支持的搜索类型: %s", config.AppConfig.Search.Driver)
+	}
+}
+
+// Terms 将关键词拆分为小写的搜索词，去掉重复的词和双引号
+func Terms(keyword string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, field := range strings.Fields(lower(keyword)) {
+		field = strings.ReplaceAll(field, `"`, "")
+		if field == "" || seen[field] {
+			continue
+		}
+		seen[field] = true
+		terms = append(terms, field)
+		if len(terms) == maxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// lower 逐个字符转为小写，保证转换前后字符数量一致，便于定位高亮位置
+func lower(s string) string {
+	return strings.Map(unicode.ToLower, s)
+}
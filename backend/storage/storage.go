@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/yourusername/gin-vue-chat/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage 文件存储后端，对象以key标识，key由调用方生成，只包含字母、数字、'/'、'-'、'_'和'.'
+type Storage interface {
+	// Put 写入对象，size为-1时表示大小未知
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，对象不存在时返回ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists 判断对象是否存在
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// Store 全局存储实例
+var Store Storage
+
+// InitStorage 根据配置初始化存储后端
+func InitStorage() {
+	var err error
+	Store, err = New()
+	if err != nil {
+		log.Fatalf("初始化文件存储失败: %v", err)
+	}
+	log.Printf("文件存储初始化完成: %s", config.AppConfig.Storage.Driver)
+}
+
+// New 根据配置创建存储后端
+func New() (Storage, error) {
+	cfg := config.AppConfig.Storage
+	switch cfg.Driver {
+	case "local", "":
+		return NewLocalStorage(cfg.LocalDir)
+	case "s3":
+		return NewS3Storage(S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("不支持的存储类型: %s", cfg.Driver)
+	}
+}
+
+// validKey 检查对象key是否安全，避免路径穿越
+func validKey(key string) bool {
+	if key == "" || key[0] == '/' || key[len(key)-1] == '/' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '/', ch == '-', ch == '_':
+		case ch == '.':
+			// 不允许出现".."
+			if i+1 < len(key) && key[i+1] == '.' {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package websocket
+
+import "sync"
+
+// blockPair 屏蔽关系，blocker屏蔽了blocked
+type blockPair struct {
+	blocker string
+	blocked string
+}
+
+// blockList 用户之间的屏蔽关系，用于在推送瞬时事件时过滤接收者
+type blockList struct {
+	pairs map[blockPair]bool
+	mu    sync.RWMutex
+}
+
+// SetBlocked 记录或取消blocker对blocked的屏蔽
+func (h *Hub) SetBlocked(blocker, blocked string, isBlocked bool) {
+	h.blocks.mu.Lock()
+	defer h.blocks.mu.Unlock()
+
+	pair := blockPair{blocker: blocker, blocked: blocked}
+	if isBlocked {
+		h.blocks.pairs[pair] = true
+	} else {
+		delete(h.blocks.pairs, pair)
+	}
+}
+
+// IsBlockedBetween 两个用户之间是否有任意一方屏蔽了另一方
+func (h *Hub) IsBlockedBetween(userID, otherID string) bool {
+	h.blocks.mu.RLock()
+	defer h.blocks.mu.RUnlock()
+
+	return h.blocks.pairs[blockPair{blocker: userID, blocked: otherID}] ||
+		h.blocks.pairs[blockPair{blocker: otherID, blocked: userID}]
+}
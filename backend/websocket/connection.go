@@ -1,8 +1,11 @@
 package websocket
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +23,10 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// 允许的最大消息大小
-	maxMessageSize = 512
+	maxMessageSize = 8192
+
+	// 客户端提供的设备ID最大长度
+	maxDeviceIDLength = 64
 )
 
 var upgrader = websocket.Upgrader{
@@ -57,9 +63,27 @@ func ServeWs(hub *Hub, c *gin.Context) {
 		return
 	}
 
+	// 设备ID由客户端通过deviceId参数提供，未提供时每个连接视为独立设备
+	sessionID := newID()
+	deviceID := c.Query("deviceId")
+	if deviceID == "" || len(deviceID) > maxDeviceIDLength {
+		deviceID = sessionID
+	}
+
 	// 创建连接和客户端
+	now := time.Now()
 	conn := &Connection{ws: ws, userID: userID.(string)}
-	client := &Client{Hub: hub, Conn: conn, UserID: userID.(string), Send: make(chan []byte, 256)}
+	client := &Client{
+		Hub:         hub,
+		Conn:        conn,
+		UserID:      userID.(string),
+		DeviceID:    deviceID,
+		SessionID:   sessionID,
+		UserAgent:   c.Request.UserAgent(),
+		ConnectedAt: now,
+		Send:        make(chan []byte, 256),
+		activeAt:    now,
+	}
 
 	// 注册客户端
 	client.Hub.register <- client
@@ -74,6 +98,23 @@ func ServeWs(hub *Hub, c *gin.Context) {
 	go client.readPump()
 }
 
+// newID 生成随机的会话ID
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// close 发送关闭帧后关闭底层连接，可以和读写并发调用
+func (conn *Connection) close(reason string) {
+	conn.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+		time.Now().Add(writeWait))
+	conn.ws.Close()
+}
+
 // readPump 从WebSocket连接泵取消息
 func (c *Client) readPump() {
 	defer func() {
@@ -90,9 +131,8 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// 处理接收到的消息
-		log.Printf("收到消息: %s", message)
-		c.Hub.broadcast <- message
+		// 按信封类型分发给对应的处理器
+		c.dispatch(message)
 	}
 }
 
@@ -114,19 +154,8 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.Conn.ws.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// 添加队列中的所有消息到当前的writer
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.Send)
-			}
-
-			if err := w.Close(); err != nil {
+			// 每个信封单独作为一帧发送，客户端可以直接对每一帧做JSON解析
+			if err := c.Conn.ws.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 		case <-ticker.C:
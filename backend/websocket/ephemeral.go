@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// 瞬时事件的过期和节流参数
+const (
+	// EphemeralTTL 瞬时事件的有效期，客户端需要在有效期内重复发送以保持状态
+	EphemeralTTL = 6 * time.Second
+	// ephemeralThrottle 同一状态两次转发之间的最小间隔，间隔内的重复开始只刷新有效期
+	ephemeralThrottle = 2 * time.Second
+	// ephemeralSweepInterval 检查过期状态的间隔
+	ephemeralSweepInterval = time.Second
+)
+
+// Ephemeral 不持久化的瞬时事件，例如正在输入、正在录音
+type Ephemeral struct {
+	// 发起者的用户ID
+	UserID string
+	// 所属会话标识
+	ConversationKey string
+	// 活动类型，同时作为推送事件的type
+	Activity string
+	// 推送事件中的其他字段
+	Fields map[string]interface{}
+}
+
+// ephemeralKey 每个用户在每个会话中的每种活动只保留一个状态
+type ephemeralKey struct {
+	userID          string
+	conversationKey string
+	activity        string
+}
+
+// ephemeralState 进行中的瞬时事件
+type ephemeralState struct {
+	event      *Ephemeral
+	recipients []string
+	expiresAt  time.Time
+	relayedAt  time.Time
+}
+
+// ephemeralTracker 记录进行中的瞬时事件
+type ephemeralTracker struct {
+	states map[ephemeralKey]*ephemeralState
+	mu     sync.Mutex
+}
+
+// StartEphemeral 开始或保持一个瞬时事件并转发给recipients，节流期间只刷新有效期，返回是否实际转发
+func (h *Hub) StartEphemeral(e *Ephemeral, recipients []string) bool {
+	key := ephemeralKey{userID: e.UserID, conversationKey: e.ConversationKey, activity: e.Activity}
+	now := time.Now()
+
+	h.ephemeral.mu.Lock()
+	state, ok := h.ephemeral.states[key]
+	if ok && now.Sub(state.relayedAt) < ephemeralThrottle {
+		state.expiresAt = now.Add(EphemeralTTL)
+		state.recipients = recipients
+		h.ephemeral.mu.Unlock()
+		return false
+	}
+	h.ephemeral.states[key] = &ephemeralState{
+		event:      e,
+		recipients: recipients,
+		expiresAt:  now.Add(EphemeralTTL),
+		relayedAt:  now,
+	}
+	h.ephemeral.mu.Unlock()
+
+	h.relayEphemeral(e, recipients, true, false)
+	return true
+}
+
+// StopEphemeral 结束用户在会话中的瞬时事件，activity为空时结束该会话中的全部活动
+func (h *Hub) StopEphemeral(userID, conversationKey, activity string) {
+	h.ephemeral.mu.Lock()
+	var stopped []*ephemeralState
+	for key, state := range h.ephemeral.states {
+		if key.userID == userID && key.conversationKey == conversationKey &&
+			(activity == "" || key.activity == activity) {
+			stopped = append(stopped, state)
+			delete(h.ephemeral.states, key)
+		}
+	}
+	h.ephemeral.mu.Unlock()
+
+	for _, state := range stopped {
+		h.relayEphemeral(state.event, state.recipients, false, false)
+	}
+}
+
+// stopUserEphemeral 结束用户的全部瞬时事件，用于用户所有设备都断开时
+func (h *Hub) stopUserEphemeral(userID string) {
+	h.ephemeral.mu.Lock()
+	var stopped []*ephemeralState
+	for key, state := range h.ephemeral.states {
+		if key.userID == userID {
+			stopped = append(stopped, state)
+			delete(h.ephemeral.states, key)
+		}
+	}
+	h.ephemeral.mu.Unlock()
+
+	for _, state := range stopped {
+		h.relayEphemeral(state.event, state.recipients, false, true)
+	}
+}
+
+// expireEphemeral 结束已过期的瞬时事件，避免客户端异常时状态一直保持
+func (h *Hub) expireEphemeral(now time.Time) {
+	h.ephemeral.mu.Lock()
+	var expired []*ephemeralState
+	for key, state := range h.ephemeral.states {
+		if now.After(state.expiresAt) {
+			expired = append(expired, state)
+			delete(h.ephemeral.states, key)
+		}
+	}
+	h.ephemeral.mu.Unlock()
+
+	for _, state := range expired {
+		h.relayEphemeral(state.event, state.recipients, false, true)
+	}
+}
+
+// relayEphemeral 向接收者推送瞬时事件的开始或结束
+func (h *Hub) relayEphemeral(e *Ephemeral, recipients []string, active, expired bool) {
+	event := make(map[string]interface{}, len(e.Fields)+5)
+	for k, v := range e.Fields {
+		event[k] = v
+	}
+	event["type"] = e.Activity
+	event["conversationKey"] = e.ConversationKey
+	event["active"] = active
+	if active {
+		event["expiresIn"] = EphemeralTTL.Milliseconds()
+	}
+	if expired {
+		event["expired"] = true
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{"data": event})
+	if err != nil {
+		log.Printf("消息序列化失败: %v", err)
+		return
+	}
+	for _, recipient := range recipients {
+		// 互相屏蔽的用户之间不转发瞬时事件
+		if h.IsBlockedBetween(e.UserID, recipient) {
+			continue
+		}
+		h.SendToUser(recipient, jsonData)
+	}
+}
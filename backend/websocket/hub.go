@@ -3,6 +3,7 @@ package websocket
 import (
 	"log"
 	"sync"
+	"time"
 )
 
 // Client 是一个中间人，在websocket连接和hub之间
@@ -11,19 +12,61 @@ type Client struct {
 	Conn *Connection
 	// 用户ID
 	UserID string
+	// 设备ID，由客户端在连接时提供，同一设备重连时保持不变
+	DeviceID string
+	// 会话ID，每个连接唯一
+	SessionID string
+	// 客户端的User-Agent
+	UserAgent string
+	// 连接建立时间
+	ConnectedAt time.Time
 	// 发送消息的通道
 	Send chan []byte
+	// 发送通道是否已关闭
+	closed bool
+	// 最后一次活动的时间，用于判断用户是否离开
+	activeAt time.Time
+	// 客户端通过心跳报告用户当前没有操作
+	idle bool
 	// 互斥锁，保护连接
 	mu sync.Mutex
 }
 
+// trySend 非阻塞地写入发送通道，通道已满或已关闭时返回false
+func (c *Client) trySend(message []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend 关闭发送通道，可重复调用
+func (c *Client) closeSend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
 // Hub 维护活跃客户端的集合并广播消息
 type Hub struct {
 	// 注册的客户端
 	clients map[*Client]bool
 
-	// 用户ID到客户端的映射
-	userClients map[string]*Client
+	// 用户ID到该用户所有设备连接的映射
+	userClients map[string]map[*Client]bool
 
 	// 从客户端入站的消息
 	broadcast chan []byte
@@ -34,6 +77,24 @@ type Hub struct {
 	// 注销请求
 	unregister chan *Client
 
+	// 入站帧类型到处理器的映射
+	handlers map[string]HandlerFunc
+
+	// 客户端注册完成后的回调
+	registerHooks []func(*Client)
+
+	// 进行中的瞬时事件
+	ephemeral ephemeralTracker
+
+	// 用户的在线状态
+	presence presenceTracker
+
+	// 在线状态变化的回调
+	presenceHooks []func(PresenceChange)
+
+	// 用户之间的屏蔽关系
+	blocks blockList
+
 	// 互斥锁，保护maps
 	mu sync.RWMutex
 }
@@ -45,77 +106,178 @@ func NewHub() *Hub {
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
 		clients:     make(map[*Client]bool),
-		userClients: make(map[string]*Client),
-		mu:          sync.RWMutex{},
+		userClients: make(map[string]map[*Client]bool),
+		handlers:    map[string]HandlerFunc{FrameTypeHeartbeat: handleHeartbeat},
+		ephemeral:   ephemeralTracker{states: make(map[ephemeralKey]*ephemeralState)},
+		presence: presenceTracker{
+			statuses: make(map[string]string),
+			pending:  make(map[string]PresenceChange),
+			notify:   make(chan struct{}, 1),
+		},
+		blocks: blockList{pairs: make(map[blockPair]bool)},
+		mu:     sync.RWMutex{},
 	}
 }
 
 // Run 启动hub的消息处理循环
 func (h *Hub) Run() {
+	sweep := time.NewTicker(ephemeralSweepInterval)
+	defer sweep.Stop()
+	presenceSweep := time.NewTicker(presenceSweepInterval)
+	defer presenceSweep.Stop()
+
+	go h.runPresenceHooks()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
 			if client.UserID != "" {
-				h.userClients[client.UserID] = client
-				log.Printf("Client registered: %s", client.UserID)
+				if h.userClients[client.UserID] == nil {
+					h.userClients[client.UserID] = make(map[*Client]bool)
+				}
+				h.userClients[client.UserID][client] = true
+				log.Printf("Client registered: %s, device: %s", client.UserID, client.DeviceID)
 			}
+			hooks := h.registerHooks
 			h.mu.Unlock()
 
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				if client.UserID != "" {
-					delete(h.userClients, client.UserID)
-					log.Printf("Client unregistered: %s", client.UserID)
-				}
-				close(client.Send)
+			// 回调可能访问数据库，放到单独的goroutine中避免阻塞消息循环
+			for _, hook := range hooks {
+				go hook(client)
 			}
-			h.mu.Unlock()
+			h.refreshPresence(client.UserID)
+
+		case client := <-h.unregister:
+			h.dropClients([]*Client{client})
 
 		case message := <-h.broadcast:
 			h.mu.RLock()
+			var slow []*Client
 			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					h.mu.RUnlock()
-					h.mu.Lock()
-					delete(h.clients, client)
-					if client.UserID != "" {
-						delete(h.userClients, client.UserID)
-					}
-					close(client.Send)
-					h.mu.Unlock()
-					h.mu.RLock()
+				if !client.trySend(message) {
+					slow = append(slow, client)
 				}
 			}
 			h.mu.RUnlock()
+
+			// 移除发送队列已满的客户端，之后readPump退出时的注销不会再处理
+			if len(slow) > 0 {
+				h.dropClients(slow)
+			}
+
+		case now := <-sweep.C:
+			h.expireEphemeral(now)
+
+		case <-presenceSweep.C:
+			h.sweepPresence()
 		}
 	}
 }
 
-// SendToUser 发送消息给特定用户
+// OnRegister 添加客户端注册完成后的回调
+func (h *Hub) OnRegister(hook func(*Client)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registerHooks = append(h.registerHooks, hook)
+}
+
+// SendMessage 向该客户端连接发送消息，发送队列已满或连接已关闭时返回false
+func (c *Client) SendMessage(message []byte) bool {
+	return c.trySend(message)
+}
+
+// dropClients 注销客户端。用户的所有设备都断开后结束其进行中的瞬时事件，并更新在线状态。
+// 已经移除的客户端会被忽略，因此被驱逐的客户端之后再注销不会重复处理
+func (h *Hub) dropClients(clients []*Client) {
+	h.mu.Lock()
+	var offline []string
+	for _, client := range clients {
+		if _, ok := h.clients[client]; !ok {
+			continue
+		}
+		h.removeClient(client)
+		log.Printf("Client unregistered: %s, device: %s", client.UserID, client.DeviceID)
+		if client.UserID != "" && len(h.userClients[client.UserID]) == 0 {
+			offline = append(offline, client.UserID)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, userID := range offline {
+		h.stopUserEphemeral(userID)
+		h.refreshPresence(userID)
+	}
+}
+
+// removeClient 从各个映射中移除客户端并关闭其发送通道，调用方需持有写锁
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	if devices, ok := h.userClients[client.UserID]; ok {
+		delete(devices, client)
+		if len(devices) == 0 {
+			delete(h.userClients, client.UserID)
+		}
+	}
+	client.closeSend()
+}
+
+// SendToUser 发送消息给特定用户的所有设备，至少有一个设备收到时返回true
 func (h *Hub) SendToUser(userID string, message []byte) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	client, exists := h.userClients[userID]
-	if !exists {
-		return false
+	sent := false
+	for client := range h.userClients[userID] {
+		if client.trySend(message) {
+			sent = true
+		}
 	}
+	return sent
+}
 
-	client.mu.Lock()
-	defer client.mu.Unlock()
+// DeviceInfo 用户的一个在线设备连接
+type DeviceInfo struct {
+	DeviceID    string    `json:"deviceId"`
+	SessionID   string    `json:"sessionId"`
+	UserAgent   string    `json:"userAgent"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
 
-	select {
-	case client.Send <- message:
-		return true
-	default:
-		return false
+// UserDevices 列出用户当前所有在线的设备连接
+func (h *Hub) UserDevices(userID string) []DeviceInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	devices := make([]DeviceInfo, 0, len(h.userClients[userID]))
+	for client := range h.userClients[userID] {
+		devices = append(devices, DeviceInfo{
+			DeviceID:    client.DeviceID,
+			SessionID:   client.SessionID,
+			UserAgent:   client.UserAgent,
+			ConnectedAt: client.ConnectedAt,
+		})
+	}
+	return devices
+}
+
+// CloseDevice 关闭用户指定设备的所有连接，返回关闭的连接数
+func (h *Hub) CloseDevice(userID, deviceID string) int {
+	h.mu.RLock()
+	var targets []*Client
+	for client := range h.userClients[userID] {
+		if client.DeviceID == deviceID {
+			targets = append(targets, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	// 关闭底层连接后readPump会退出并自动注销客户端
+	for _, client := range targets {
+		client.Conn.close("设备已下线")
 	}
+	return len(targets)
 }
 
 // Broadcast 广播消息给所有连接的客户端
@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// startTestHub 启动hub并收集在线状态变化
+func startTestHub(t *testing.T) (*Hub, chan PresenceChange) {
+	t.Helper()
+	h := NewHub()
+	changes := make(chan PresenceChange, 64)
+	h.OnPresenceChange(func(change PresenceChange) {
+		changes <- change
+	})
+	go h.Run()
+	return h, changes
+}
+
+func expectChange(t *testing.T, changes chan PresenceChange, userID, status string) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		if change.UserID != userID || change.Status != status {
+			t.Fatalf("change = %s %s, want %s %s", change.UserID, change.Status, userID, status)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no presence change, want %s %s", userID, status)
+	}
+}
+
+func expectNoChange(t *testing.T, changes chan PresenceChange) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %s %s", change.UserID, change.Status)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// deviceCount 通过hub的消息循环同步后返回用户的设备数
+func deviceCount(h *Hub, userID string) int {
+	return len(h.UserDevices(userID))
+}
+
+func TestHubMultiDevicePresence(t *testing.T) {
+	h, changes := startTestHub(t)
+
+	phone := testClient(h, "1", "phone")
+	laptop := testClient(h, "1", "laptop")
+
+	tests := []struct {
+		name       string
+		action     func()
+		devices    int
+		wantChange string // 为空时不应有状态变化
+	}{
+		{"first device goes online", func() { h.register <- phone }, 1, PresenceOnline},
+		{"second device keeps status", func() { h.register <- laptop }, 2, ""},
+		{"one device leaves", func() { h.unregister <- phone }, 1, ""},
+		{"repeated unregister ignored", func() { h.unregister <- phone }, 1, ""},
+		{"last device leaves", func() { h.unregister <- laptop }, 0, PresenceOffline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.action()
+			if tt.wantChange != "" {
+				expectChange(t, changes, "1", tt.wantChange)
+			} else {
+				expectNoChange(t, changes)
+			}
+			if got := deviceCount(h, "1"); got != tt.devices {
+				t.Errorf("devices = %d, want %d", got, tt.devices)
+			}
+		})
+	}
+
+	// 注销的客户端发送通道被关闭
+	if _, ok := <-phone.Send; ok {
+		t.Error("unregistered client's send channel should be closed")
+	}
+}
+
+func TestHubSendToUserReachesAllDevices(t *testing.T) {
+	h, changes := startTestHub(t)
+
+	a, b := testClient(h, "1", "a"), testClient(h, "1", "b")
+	other := testClient(h, "2", "c")
+	for _, client := range []*Client{a, b, other} {
+		h.register <- client
+	}
+	expectChange(t, changes, "1", PresenceOnline)
+	expectChange(t, changes, "2", PresenceOnline)
+
+	if !h.SendToUser("1", []byte("hello")) {
+		t.Fatal("SendToUser returned false")
+	}
+	for _, client := range []*Client{a, b} {
+		if got := <-client.Send; !bytes.Equal(got, []byte("hello")) {
+			t.Errorf("device %s got %q", client.DeviceID, got)
+		}
+	}
+	select {
+	case got := <-other.Send:
+		t.Errorf("other user got %q", got)
+	default:
+	}
+	if h.SendToUser("3", []byte("hello")) {
+		t.Error("SendToUser to an offline user returned true")
+	}
+}
+
+func TestHubEvictsSlowClients(t *testing.T) {
+	h, changes := startTestHub(t)
+
+	// 发送通道没有缓冲，广播时一定写不进去
+	slow := testClient(h, "1", "slow")
+	slow.Send = make(chan []byte)
+	fast := testClient(h, "2", "fast")
+	h.register <- slow
+	h.register <- fast
+	expectChange(t, changes, "1", PresenceOnline)
+	expectChange(t, changes, "2", PresenceOnline)
+
+	// 被驱逐的用户正在输入，需要随离线一起结束
+	h.StartEphemeral(&Ephemeral{UserID: "1", ConversationKey: "p_1_2", Activity: "typing"}, []string{"2"})
+	<-fast.Send
+
+	h.Broadcast([]byte("broadcast"))
+	expectChange(t, changes, "1", PresenceOffline)
+	if got := <-fast.Send; !bytes.Equal(got, []byte("broadcast")) {
+		t.Fatalf("fast client got %q", got)
+	}
+	if got := <-fast.Send; !bytes.Contains(got, []byte(`"active":false`)) {
+		t.Errorf("typing was not stopped for the evicted user: %q", got)
+	}
+	if got := deviceCount(h, "1"); got != 0 {
+		t.Errorf("evicted user still has %d devices", got)
+	}
+	if status, _ := h.UserPresence("1"); status != PresenceOffline {
+		t.Errorf("evicted user presence = %s, want offline", status)
+	}
+
+	// readPump退出时的注销不会重复通知
+	h.unregister <- slow
+	expectNoChange(t, changes)
+	if _, ok := <-slow.Send; ok {
+		t.Error("evicted client's send channel should be closed")
+	}
+}
@@ -0,0 +1,196 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// 在线状态
+const (
+	PresenceOnline  = "online"  // 至少一个设备在活跃使用
+	PresenceAway    = "away"    // 有设备在线但都处于空闲
+	PresenceOffline = "offline" // 没有设备在线
+)
+
+const (
+	// FrameTypeHeartbeat 客户端心跳帧，负载为 {"idle": true} 时表示用户当前没有操作
+	FrameTypeHeartbeat = "heartbeat"
+
+	// awayAfter 设备超过该时间没有活动即视为空闲
+	awayAfter = 5 * time.Minute
+
+	// presenceSweepInterval 检查空闲设备的间隔
+	presenceSweepInterval = 15 * time.Second
+)
+
+// PresenceChange 用户在线状态的变化
+type PresenceChange struct {
+	UserID     string
+	Status     string
+	LastSeenAt time.Time // 用户最后一次活动的时间
+}
+
+// presenceTracker 记录每个用户最近一次通知出去的在线状态
+type presenceTracker struct {
+	statuses map[string]string
+	// 等待执行回调的状态变化，每个用户只保留最新的一次，按用户第一次排队的先后顺序执行。
+	// 回调访问数据库可能很慢，排队不能阻塞hub的消息循环
+	pending map[string]PresenceChange
+	order   []string
+	// 有新的状态变化时通知runPresenceHooks
+	notify chan struct{}
+	mu     sync.Mutex
+}
+
+// heartbeatPayload 心跳帧的负载
+type heartbeatPayload struct {
+	Idle bool `json:"idle"`
+}
+
+// OnPresenceChange 添加在线状态变化的回调，回调在单独的goroutine中按变化的先后顺序执行
+func (h *Hub) OnPresenceChange(hook func(PresenceChange)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.presenceHooks = append(h.presenceHooks, hook)
+}
+
+// touch 记录客户端的一次活动
+func (c *Client) touch(idle bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.idle = idle
+	if !idle {
+		c.activeAt = time.Now()
+	}
+}
+
+// activity 返回客户端是否空闲以及最后活动时间
+func (c *Client) activity(now time.Time) (bool, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.idle || now.Sub(c.activeAt) > awayAfter, c.activeAt
+}
+
+// handleHeartbeat 处理客户端心跳，更新设备的活跃状态
+func handleHeartbeat(c *Client, payload json.RawMessage) (interface{}, error) {
+	var req heartbeatPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, NewError(ErrCodeBadRequest, "请求参数无效")
+		}
+	}
+
+	c.touch(req.Idle)
+	c.Hub.refreshPresence(c.UserID)
+	return nil, nil
+}
+
+// UserPresence 根据用户所有设备的状态计算在线状态
+func (h *Hub) UserPresence(userID string) (string, time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.userPresence(userID, time.Now())
+}
+
+// userPresence 计算在线状态，调用方需持有读锁
+func (h *Hub) userPresence(userID string, now time.Time) (string, time.Time) {
+	devices := h.userClients[userID]
+	if len(devices) == 0 {
+		return PresenceOffline, now
+	}
+
+	status := PresenceAway
+	var lastSeenAt time.Time
+	for client := range devices {
+		idle, activeAt := client.activity(now)
+		if !idle {
+			status = PresenceOnline
+		}
+		if activeAt.After(lastSeenAt) {
+			lastSeenAt = activeAt
+		}
+	}
+	if status == PresenceOnline {
+		lastSeenAt = now
+	}
+	return status, lastSeenAt
+}
+
+// refreshPresence 重新计算用户的在线状态，发生变化时通知回调
+func (h *Hub) refreshPresence(userID string) {
+	if userID == "" {
+		return
+	}
+
+	// 计算和排队都在锁内完成，保证同一用户的状态变化按顺序通知
+	h.presence.mu.Lock()
+	defer h.presence.mu.Unlock()
+
+	h.mu.RLock()
+	status, lastSeenAt := h.userPresence(userID, time.Now())
+	h.mu.RUnlock()
+
+	previous, ok := h.presence.statuses[userID]
+	if !ok {
+		previous = PresenceOffline
+	}
+	if previous == status {
+		return
+	}
+	if status == PresenceOffline {
+		delete(h.presence.statuses, userID)
+	} else {
+		h.presence.statuses[userID] = status
+	}
+
+	if _, queued := h.presence.pending[userID]; !queued {
+		h.presence.order = append(h.presence.order, userID)
+	}
+	h.presence.pending[userID] = PresenceChange{UserID: userID, Status: status, LastSeenAt: lastSeenAt}
+	select {
+	case h.presence.notify <- struct{}{}:
+	default:
+	}
+}
+
+// sweepPresence 检查所有在线用户，将长时间没有活动的用户标记为离开
+func (h *Hub) sweepPresence() {
+	h.mu.RLock()
+	userIDs := make([]string, 0, len(h.userClients))
+	for userID := range h.userClients {
+		userIDs = append(userIDs, userID)
+	}
+	h.mu.RUnlock()
+
+	for _, userID := range userIDs {
+		h.refreshPresence(userID)
+	}
+}
+
+// runPresenceHooks 按顺序执行在线状态变化的回调。回调执行期间同一用户的多次变化会合并，只通知最新的状态
+func (h *Hub) runPresenceHooks() {
+	for range h.presence.notify {
+		for {
+			h.presence.mu.Lock()
+			if len(h.presence.order) == 0 {
+				h.presence.mu.Unlock()
+				break
+			}
+			userID := h.presence.order[0]
+			h.presence.order = h.presence.order[1:]
+			change := h.presence.pending[userID]
+			delete(h.presence.pending, userID)
+			h.presence.mu.Unlock()
+
+			h.mu.RLock()
+			hooks := h.presenceHooks
+			h.mu.RUnlock()
+
+			for _, hook := range hooks {
+				hook(change)
+			}
+		}
+	}
+}
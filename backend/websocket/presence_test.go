@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// testClient 创建不带底层连接的客户端
+func testClient(h *Hub, userID, deviceID string) *Client {
+	return &Client{
+		Hub:       h,
+		UserID:    userID,
+		DeviceID:  deviceID,
+		SessionID: deviceID,
+		Send:      make(chan []byte, 16),
+		activeAt:  time.Now(),
+	}
+}
+
+// setDevices 直接设置用户的在线设备，模拟注册和注销
+func setDevices(h *Hub, userID string, clients ...*Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(clients) == 0 {
+		delete(h.userClients, userID)
+		return
+	}
+	h.userClients[userID] = make(map[*Client]bool)
+	for _, client := range clients {
+		h.userClients[userID][client] = true
+	}
+}
+
+func TestRefreshPresenceDoesNotBlockOnSlowHooks(t *testing.T) {
+	h := NewHub()
+	changes := make(chan PresenceChange)
+	proceed := make(chan struct{})
+	h.OnPresenceChange(func(change PresenceChange) {
+		changes <- change
+		<-proceed
+	})
+	go h.runPresenceHooks()
+
+	client := testClient(h, "1", "a")
+	setDevices(h, "1", client)
+	h.refreshPresence("1")
+	// 回调阻塞在第一次变化上，期间的变化只能排队
+	if change := <-changes; change.Status != PresenceOnline {
+		t.Fatalf("first change = %s, want online", change.Status)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			setDevices(h, "1")
+			h.refreshPresence("1")
+			setDevices(h, "1", client)
+			h.refreshPresence("1")
+			setDevices(h, "2", testClient(h, "2", "b"))
+			h.refreshPresence("2")
+			setDevices(h, "2")
+			h.refreshPresence("2")
+		}
+		setDevices(h, "1")
+		h.refreshPresence("1")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("refreshPresence blocked while hooks were busy")
+	}
+	close(proceed)
+
+	// 每个用户只收到最新的状态，按第一次排队的顺序
+	want := []PresenceChange{{UserID: "1", Status: PresenceOffline}, {UserID: "2", Status: PresenceOffline}}
+	for _, w := range want {
+		select {
+		case change := <-changes:
+			if change.UserID != w.UserID || change.Status != w.Status {
+				t.Fatalf("change = %s %s, want %s %s", change.UserID, change.Status, w.UserID, w.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing change for %s", w.UserID)
+		}
+	}
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %+v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
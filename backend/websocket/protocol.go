@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// ProtocolVersion 当前WebSocket协议版本
+const ProtocolVersion = 1
+
+// 服务端回复帧类型
+const (
+	FrameTypeAck   = "ack"   // 处理成功的确认帧
+	FrameTypeError = "error" // 处理失败的错误帧
+)
+
+// 错误码
+const (
+	ErrCodeBadFrame    = "bad_frame"    // 帧格式无效
+	ErrCodeBadVersion  = "bad_version"  // 协议版本不支持
+	ErrCodeUnknownType = "unknown_type" // 未知的帧类型
+	ErrCodeBadRequest  = "bad_request"  // 请求参数无效
+	ErrCodeForbidden   = "forbidden"    // 没有权限
+	ErrCodeNotFound    = "not_found"    // 资源不存在
+	ErrCodeInternal    = "internal"     // 服务器内部错误
+)
+
+// Envelope 客户端发送的入站消息信封
+type Envelope struct {
+	// 协议版本
+	Version int `json:"v"`
+	// 帧类型，决定由哪个处理器处理
+	Type string `json:"type"`
+	// 客户端生成的帧ID，回复时原样带回
+	ID string `json:"id,omitempty"`
+	// 具体类型的负载
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Reply 服务端对入站帧的回复
+type Reply struct {
+	Version int         `json:"v"`
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// Error 返回给客户端的协议错误
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError 创建协议错误
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// HandlerFunc 处理某一类型的入站帧，返回值作为ack帧的负载
+type HandlerFunc func(c *Client, payload json.RawMessage) (interface{}, error)
+
+// Handle 注册某一帧类型的处理器
+func (h *Hub) Handle(frameType string, handler HandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[frameType] = handler
+}
+
+// dispatch 解析入站帧并交给对应的处理器
+func (c *Client) dispatch(raw []byte) {
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil || env.Type == "" {
+		c.replyError("", NewError(ErrCodeBadFrame, "消息格式无效"))
+		return
+	}
+
+	if env.Version != ProtocolVersion {
+		c.replyError(env.ID, NewError(ErrCodeBadVersion, "不支持的协议版本"))
+		return
+	}
+
+	// 除空闲心跳外的任何入站帧都视为用户活动
+	if env.Type != FrameTypeHeartbeat {
+		c.touch(false)
+		c.Hub.refreshPresence(c.UserID)
+	}
+
+	c.Hub.mu.RLock()
+	handler, ok := c.Hub.handlers[env.Type]
+	c.Hub.mu.RUnlock()
+	if !ok {
+		c.replyError(env.ID, NewError(ErrCodeUnknownType, "未知的消息类型: "+env.Type))
+		return
+	}
+
+	result, err := handler(c, env.Payload)
+	if err != nil {
+		protoErr, ok := err.(*Error)
+		if !ok {
+			log.Printf("处理WebSocket消息失败: type=%s, 错误: %v", env.Type, err)
+			protoErr = NewError(ErrCodeInternal, "服务器错误")
+		}
+		c.replyError(env.ID, protoErr)
+		return
+	}
+
+	c.reply(&Reply{Version: ProtocolVersion, Type: FrameTypeAck, ID: env.ID, Payload: result})
+}
+
+// replyError 回复错误帧
+func (c *Client) replyError(id string, err *Error) {
+	c.reply(&Reply{Version: ProtocolVersion, Type: FrameTypeError, ID: id, Error: err})
+}
+
+// reply 将回复帧写入客户端的发送队列
+func (c *Client) reply(r *Reply) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("回复序列化失败: %v", err)
+		return
+	}
+	c.trySend(data)
+}
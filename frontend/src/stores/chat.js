@@ -72,8 +72,15 @@ export const useChatStore = defineStore('chat', () => {
   }
   
   // 处理接收到的消息
-  function handleIncomingMessage(data) {
-    const { type, message } = data
+  function handleIncomingMessage(frame) {
+    // ack/error 是服务端对本端发送帧的回复，推送事件包裹在 data 字段中
+    if (frame.type === 'ack' || frame.type === 'error') {
+      if (frame.type === 'error') {
+        console.warn('WebSocket请求失败:', frame.error)
+      }
+      return
+    }
+    const { type, message } = frame.data || frame
     
     if (type === 'private') {
       // 私聊消息
@@ -135,21 +142,8 @@ export const useChatStore = defineStore('chat', () => {
     }
     
     try {
-      const message = {
-        type: 'private',
-        message: {
-          from: userStore.userId,
-          to: receiverId,
-          content,
-          timestamp: new Date().toISOString()
-        }
-      }
-      
-      // 通过WebSocket发送消息
-      socket.value.send(JSON.stringify(message))
-      
-      // 同时通过API保存消息 - 修复：将receiverId转换为字符串类型
-      await userStore.http.post('/api/messages/private', {
+      // 通过API保存消息，服务端会推送给接收者 - 修复：将receiverId转换为字符串类型
+      const response = await userStore.http.post('/api/messages/private', {
         receiverId: receiverId.toString(), // 转换为字符串
         content
       })
@@ -159,12 +153,7 @@ export const useChatStore = defineStore('chat', () => {
         privateChats.value[receiverId] = []
       }
       
-      // privateChats.value[receiverId].push({
-      //   id: Date.now().toString(),
-      //   senderId: userStore.userId,
-      //   content,
-      //   timestamp: new Date().toISOString()
-      // })
+      privateChats.value[receiverId].push(response.data.data)
       
       return { success: true }
     } catch (error) {
@@ -183,21 +172,8 @@ export const useChatStore = defineStore('chat', () => {
     }
     
     try {
-      const message = {
-        type: 'group',
-        message: {
-          groupId,
-          senderId: userStore.userId,
-          content,
-          timestamp: new Date().toISOString()
-        }
-      }
-      
-      // 通过WebSocket发送消息
-      socket.value.send(JSON.stringify(message))
-      
-      // 同时通过API保存消息 - 修复：将groupId转换为字符串类型
-      await userStore.http.post('/api/messages/group', {
+      // 通过API保存消息，服务端会推送给其他成员 - 修复：将groupId转换为字符串类型
+      const response = await userStore.http.post('/api/messages/group', {
         groupId: groupId.toString(), // 转换为字符串
         content
       })
@@ -207,12 +183,7 @@ export const useChatStore = defineStore('chat', () => {
         groupChats.value[groupId] = []
       }
       
-      // groupChats.value[groupId].push({
-      //   id: Date.now().toString(),
-      //   senderId: userStore.userId,
-      //   content,
-      //   timestamp: new Date().toISOString()
-      // })
+      groupChats.value[groupId].push(response.data.data)
       
       return { success: true }
     } catch (error) {